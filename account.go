@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Account is the serialised format of the data kept about a player, rather
+// than their character.
+type Account struct {
+	Name        string      `yaml:"name"`
+	Builder     bool        `yaml:"builder"` // Builders can see the whole of an area with 'map full'
+	Admin       bool        `yaml:"admin"`   // Admins can change the server's screens
+	Preferences Preferences `yaml:"preferences"`
+	SSHKeys     []string    `yaml:"ssh_keys,omitempty"` // Public keys, in authorized_keys format, that can log in over SSH
+}
+
+// Preferences are a player's choices about how the game's output is shown.
+type Preferences struct {
+	Colour string            `yaml:"colour"`          // auto, on or off
+	Theme  map[string]string `yaml:"theme,omitempty"` // Parts of the output to the colours the player has picked for them
+	// Columns to wrap output to, zero to use the client's window width.
+	Width int `yaml:"width,omitempty"`
+	// Lines of output to show before pausing, zero to use the client's
+	// window height and -1 to never pause.
+	PageLength int `yaml:"page_length,omitempty"`
+	// The player's prompt, empty for the default.
+	Prompt string `yaml:"prompt,omitempty"`
+}
+
+// Character is the serialised format of a player's character between
+// sessions.
+type Character struct {
+	Name     string   `yaml:"name"`
+	Visited  []string `yaml:"visited"`  // IDs of the Rooms the character has been in
+	Location string   `yaml:"location"` // ID of the Room the character was last in
+}
+
+// Returns true if name is usable as a character name. Names are also used
+// for file names by some stores, so are restricted to letters and digits.
+func validName(name string) bool {
+	if len(name) < 2 || len(name) > 20 {
+		return false
+	}
+	for _, r := range name {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Loads the Mob's saved state from the account and character called name.
+// A new player gets a fresh account, which is saved straight away.
+func (m *Mob) load(name string) error {
+	account, err := store.LoadAccount(name)
+	if errors.Is(err, ErrNotFound) {
+		account = Account{Name: name}
+		err = store.SaveAccount(account)
+	}
+	if err != nil {
+		return err
+	}
+	character, err := store.LoadCharacter(name)
+	if errors.Is(err, ErrNotFound) {
+		character = Character{Name: name}
+	} else if err != nil {
+		return err
+	}
+	m.visitedLock.Lock()
+	defer m.visitedLock.Unlock()
+	m.builder = account.Builder
+	m.admin = account.Admin
+	m.prefs = account.Preferences
+	m.respawnAt = character.Location
+	for _, id := range character.Visited {
+		m.visited[id] = true
+	}
+	return nil
+}
+
+// Returns a copy of the Mob's preferences.
+func (m *Mob) getPreferences() Preferences {
+	m.prefsLock.Lock()
+	defer m.prefsLock.Unlock()
+	prefs := m.prefs
+	prefs.Theme = make(map[string]string)
+	for part, colour := range m.prefs.Theme {
+		prefs.Theme[part] = colour
+	}
+	return prefs
+}
+
+// Changes the Mob's preferences with change, then saves them to its account.
+func (m *Mob) updatePreferences(change func(*Preferences)) {
+	prefs := m.getPreferences()
+	change(&prefs)
+	m.prefsLock.Lock()
+	m.prefs = prefs
+	m.prefsLock.Unlock()
+	err := updateAccount(m.name, func(account *Account) {
+		account.Preferences = prefs
+	})
+	if err != nil {
+		log.WithError(err).Errorf("Could not save account '%v'.", m.name)
+	}
+}
+
+// Loads the account called name, changes it with change, then saves it.
+func updateAccount(name string, change func(*Account)) error {
+	account, err := store.LoadAccount(name)
+	if err != nil {
+		return err
+	}
+	change(&account)
+	return store.SaveAccount(account)
+}
+
+// Saves the Mob's state to its character.
+func (m *Mob) save() error {
+	return store.SaveCharacter(m.character())
+}
+
+// Returns the Mob's state as it would be saved. A Mob that hasn't spawned
+// yet is where it will spawn.
+func (m *Mob) character() Character {
+	character := Character{Name: m.name, Location: m.respawnAt}
+	if location := m.getLocation(); location != nil {
+		character.Location = location.id
+	}
+	m.visitedLock.Lock()
+	for id := range m.visited {
+		character.Visited = append(character.Visited, id)
+	}
+	m.visitedLock.Unlock()
+	sort.Strings(character.Visited)
+	return character
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How long the API waits for a Mob to run an action it has queued.
+const apiActionTimeout = 5 * time.Second
+
+// The admin API, served under /api/ on the admin listener. Every request
+// needs the header "Authorization: Bearer <admin token>".
+//
+//	GET  /api/users                  - list the players
+//	POST /api/users/<name>/kick      - disconnect a player, {"reason": "..."}
+//	POST /api/broadcast              - tell every player something, {"message": "..."}
+//	GET  /api/rooms/<id>             - a Room's contents and exits
+//	POST /api/mobs/<name>/move       - move a Mob, {"room": "<id>", "walk": false}
+//	POST /api/areas/<name>/reload    - reload an Area's text from the world directory
+//	POST /api/save                   - save the world
+//
+// Anything that changes a Mob is queued for it, like a command, so it runs
+// on the Mob's own pulse rather than racing it.
+func apiHandler(w http.ResponseWriter, r *http.Request) {
+	if !apiAuthorised(r) {
+		writeAPIError(w, http.StatusUnauthorized, errors.New("A valid admin token is needed."))
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/"), "/")
+	route := r.Method + " " + parts[0]
+	if len(parts) == 3 {
+		route += " " + parts[2]
+	}
+	var result interface{}
+	var err error
+	switch {
+	case route == "GET users" && len(parts) == 1:
+		result = serverStatus().Players
+	case route == "POST users kick":
+		var body struct{ Reason string }
+		if err = readAPIBody(w, r, &body); err == nil {
+			result, err = apiKick(parts[1], body.Reason)
+		}
+	case route == "POST broadcast" && len(parts) == 1:
+		var body struct{ Message string }
+		if err = readAPIBody(w, r, &body); err == nil {
+			result, err = apiBroadcast(body.Message)
+		}
+	case route == "GET rooms" && len(parts) == 2:
+		result, err = apiRoom(parts[1])
+	case route == "POST mobs move":
+		var body struct {
+			Room string
+			Walk bool
+		}
+		if err = readAPIBody(w, r, &body); err == nil {
+			result, err = apiMove(parts[1], body.Room, body.Walk)
+		}
+	case route == "POST areas reload":
+		result, err = apiReload(parts[1])
+	case route == "POST save" && len(parts) == 1:
+		world.save()
+		audit(streamAdmin, "api", "Saved the world.")
+		result = map[string]string{"result": "World saved."}
+	default:
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("No such API call: %v %v", r.Method, r.URL.Path))
+		return
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.As(err, new(apiNotFoundError)) {
+			status = http.StatusNotFound
+		} else if errors.As(err, new(apiConflictError)) {
+			status = http.StatusConflict
+		}
+		writeAPIError(w, status, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Returns true if the request carries the admin token. With no token
+// configured, the API is off and nothing is authorised.
+func apiAuthorised(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && config.AdminToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) == 1
+}
+
+func readAPIBody(w http.ResponseWriter, r *http.Request, body interface{}) error {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(body); err != nil {
+		return fmt.Errorf("Could not read the request body: %w", err)
+	}
+	return nil
+}
+
+// apiNotFoundError is reported by the API as a 404.
+type apiNotFoundError struct{ error }
+
+func apiNotFound(format string, args ...interface{}) error {
+	return apiNotFoundError{fmt.Errorf(format, args...)}
+}
+
+// apiConflictError is reported by the API as a 409, for a call that can't be
+// made while the thing it's about is in its current state.
+type apiConflictError struct{ error }
+
+func apiConflict(format string, args ...interface{}) error {
+	return apiConflictError{fmt.Errorf(format, args...)}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// Finds the Mob called name anywhere in the world: a player, a linkdead
+// player or an NPC.
+func findMob(name string) *Mob {
+	for _, room := range world.rooms {
+		room.RLock()
+		for _, thing := range room.contents {
+			if mob, ok := thing.(*Mob); ok && strings.EqualFold(mob.name, name) {
+				room.RUnlock()
+				return mob
+			}
+		}
+		room.RUnlock()
+	}
+	return nil
+}
+
+// Queues action for the Mob and waits for it to run, as though the Mob had
+// typed a command.
+func runQueued(m *Mob, action ReadiedCommand) (bool, error) {
+	done := make(chan bool, 1)
+	if !m.enqueue(func() bool {
+		result := action()
+		done <- result
+		return result
+	}) {
+		return false, fmt.Errorf("%v has too many commands queued.", m.name)
+	}
+	select {
+	case result := <-done:
+		return result, nil
+	case <-time.After(apiActionTimeout):
+		return false, fmt.Errorf("%v didn't get round to it in time.", m.name)
+	}
+}
+
+func apiKick(name, reason string) (interface{}, error) {
+	if m := findLinkdead(name); m != nil {
+		// The Mob is only taken from the linkdead list on its own beat, in
+		// case its player has come back by then.
+		kicked, err := runQueued(m, func() bool {
+			if reclaimLinkdead(name) != m {
+				return false
+			}
+			m.logout()
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !kicked {
+			return nil, apiConflict("%v reconnected before they could be kicked.", name)
+		}
+	} else {
+		m := findMob(name)
+		if m == nil {
+			return nil, apiNotFound("No player called '%v' is connected.", name)
+		}
+		user, err := getUserFromMob(m)
+		if err != nil {
+			return nil, apiNotFound("No player called '%v' is connected.", name)
+		}
+		if reason == "" {
+			reason = "no reason given"
+		}
+		if _, err := runQueued(m, func() bool {
+			user.write(fmt.Sprintf("You have been kicked by an admin: %v\n", reason))
+			m.logout()
+			disconnectUserFromMob(m)
+			return true
+		}); err != nil {
+			return nil, err
+		}
+	}
+	audit(streamAdmin, "api", "Kicked %v: %v", name, reason)
+	return map[string]string{"result": fmt.Sprintf("Kicked %v.", name)}, nil
+}
+
+func apiBroadcast(message string) (interface{}, error) {
+	if strings.TrimSpace(message) == "" {
+		return nil, errors.New("There's no message to broadcast.")
+	}
+	usersLock.Lock()
+	for _, user := range users {
+		user.Mob.tell(fmt.Sprintf("{Y}[Broadcast] %v{x}\n", escapeMarkup(message)))
+	}
+	told := len(users)
+	usersLock.Unlock()
+	audit(streamAdmin, "api", "Broadcast: %v", message)
+	return map[string]int{"told": told}, nil
+}
+
+// APIRoom is the serialised format of a Room returned by the API.
+type APIRoom struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Area        string    `json:"area"`
+	Description string    `json:"description"`
+	Contents    []string  `json:"contents"`
+	Exits       []APIExit `json:"exits"`
+}
+
+// APIExit is the serialised format of an Exit returned by the API.
+type APIExit struct {
+	Name        string `json:"name"`
+	Destination string `json:"destination"` // ID of the Room the Exit leads to
+	Door        string `json:"door,omitempty"`
+}
+
+func apiRoom(id string) (interface{}, error) {
+	room := world.getRoom(id)
+	if room == nil {
+		return nil, apiNotFound("There's no room '%v'.", id)
+	}
+	room.RLock()
+	defer room.RUnlock()
+	output := APIRoom{ID: room.id, Name: room.name, Description: room.description, Contents: []string{}, Exits: []APIExit{}}
+	if room.area != nil {
+		output.Area = room.area.name
+	}
+	for _, thing := range room.contents {
+		output.Contents = append(output.Contents, thing.getName())
+	}
+	for _, exit := range room.exits {
+		apiExit := APIExit{Name: exit.getPrimaryName(), Destination: exit.getDestination().id}
+		if exit.door != nil {
+			apiExit.Door = "open"
+			if !exit.isOpen() {
+				apiExit.Door = "closed"
+			}
+		}
+		output.Exits = append(output.Exits, apiExit)
+	}
+	return output, nil
+}
+
+// Moves the Mob called name to the Room roomID. It's moved there straight
+// away, or if walk is true, sent to walk there a Room each beat.
+func apiMove(name, roomID string, walk bool) (interface{}, error) {
+	m := findMob(name)
+	if m == nil {
+		return nil, apiNotFound("There's no mob called '%v'.", name)
+	}
+	if m.linkdead.Load() {
+		return nil, apiConflict("%v is linkdead.", m.name)
+	}
+	target := world.getRoom(roomID)
+	if target == nil {
+		return nil, apiNotFound("There's no room '%v'.", roomID)
+	}
+	if walk {
+		var walkErr error
+		if _, err := runQueued(m, func() bool {
+			walkErr = m.walkTo(target)
+			return walkErr == nil
+		}); err != nil {
+			return nil, err
+		}
+		if walkErr != nil {
+			return nil, walkErr
+		}
+		audit(streamAdmin, "api", "Sent %v walking to %v.", m.name, target.id)
+		return map[string]string{"result": fmt.Sprintf("%v is walking to %v.", m.name, target.name)}, nil
+	}
+	if _, err := runQueued(m, func() bool {
+		from := m.location
+		from.leaveRoom(m)
+		world.roomEmit(fmt.Sprintf("%v vanishes.\n", m.name), from)
+		world.roomEmit(fmt.Sprintf("%v appears.\n", m.name), target)
+		target.enterRoom(m)
+		m.tell(target.displayRoom(m.textWidth()))
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	audit(streamAdmin, "api", "Moved %v to %v.", m.name, target.id)
+	return map[string]string{"result": fmt.Sprintf("Moved %v to %v.", m.name, target.name)}, nil
+}
+
+func apiReload(area string) (interface{}, error) {
+	updated, skipped, err := world.reloadArea(area)
+	if err != nil {
+		return nil, err
+	}
+	audit(streamAdmin, "api", "Reloaded the %v area.", area)
+	return map[string]int{"updated": updated, "skipped": skipped}, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIStatuses(t *testing.T) {
+	h, err := newHarness("testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	token := config.AdminToken
+	config.AdminToken = "secret"
+	defer func() { config.AdminToken = token }()
+	server := httptest.NewServer(adminHandler())
+	defer server.Close()
+
+	if err := h.connect().expect("alice", "You shall be known as 'alice'"); err != nil {
+		t.Fatal(err)
+	}
+	// Bob's connection drops, leaving him linkdead.
+	bob := h.connect()
+	if err := bob.expect("bob", "You shall be known as 'bob'"); err != nil {
+		t.Fatal(err)
+	}
+	bob.close()
+	start := `{"room": "` + world.getStartRoom().id + `"}`
+
+	for _, test := range []struct {
+		method, path, body string
+		token              string
+		want               int
+	}{
+		{"GET", "/api/users", "", "wrong", http.StatusUnauthorized},
+		{"GET", "/api/users", "", "secret", http.StatusOK},
+		{"GET", "/api/nothing", "", "secret", http.StatusNotFound},
+		{"POST", "/api/users/carol/kick", `{"reason": "Testing."}`, "secret", http.StatusNotFound},
+		{"POST", "/api/mobs/carol/move", start, "secret", http.StatusNotFound},
+		{"POST", "/api/mobs/alice/move", `{"room": "nowhere"}`, "secret", http.StatusNotFound},
+		{"POST", "/api/mobs/bob/move", start, "secret", http.StatusConflict},
+	} {
+		request, err := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Authorization", "Bearer "+test.token)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != test.want {
+			t.Errorf("%v %v gave %v, want %v.", test.method, test.path, response.StatusCode, test.want)
+		}
+	}
+}
+
+func TestAPIKickLinkdead(t *testing.T) {
+	h, err := newHarness("testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	token := config.AdminToken
+	config.AdminToken = "secret"
+	defer func() { config.AdminToken = token }()
+	server := httptest.NewServer(adminHandler())
+	defer server.Close()
+	bob := h.connect()
+	if err := bob.expect("bob", "You shall be known as 'bob'"); err != nil {
+		t.Fatal(err)
+	}
+	bob.close()
+
+	// The kick waits for bob's Mob to take its turn, so the world is kept
+	// beating until it's answered.
+	statuses := make(chan int)
+	go func() {
+		request, _ := http.NewRequest("POST", server.URL+"/api/users/bob/kick", strings.NewReader(`{"reason": "Testing."}`))
+		request.Header.Set("Authorization", "Bearer secret")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Error(err)
+			statuses <- -1
+			return
+		}
+		response.Body.Close()
+		statuses <- response.StatusCode
+	}()
+	for status := 0; status == 0; {
+		select {
+		case status = <-statuses:
+			if status != http.StatusOK {
+				t.Errorf("Kicking linkdead bob gave %v, want %v.", status, http.StatusOK)
+			}
+		default:
+			h.step(1)
+		}
+	}
+	if findLinkdead("bob") != nil || findMob("bob") != nil {
+		t.Error("bob was left in the world after being kicked.")
+	}
+}
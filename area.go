@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Areas are the collections of Rooms loaded from a single map directory.
+// Each Room keeps the position it was drawn at on the area's text map.
+type Area struct {
+	name          string
+	width, height int
+	rooms         []*Room
+	grid          map[Coordinates]*Room
+}
+
+func newArea(name string, width, height int) *Area {
+	return &Area{
+		name:   name,
+		width:  width,
+		height: height,
+		grid:   make(map[Coordinates]*Room),
+	}
+}
+
+// Adds a Room to the Area at the Room's coordinates and gives it an ID made
+// from the area's name and those coordinates.
+func (a *Area) addRoom(r *Room) {
+	r.area = a
+	r.id = fmt.Sprintf("%s:%d,%d", a.name, r.coords.x, r.coords.y)
+	a.rooms = append(a.rooms, r)
+	a.grid[r.coords] = r
+}
+
+// Returns the Room at coords, or nil if there isn't one.
+func (a *Area) roomAt(coords Coordinates) *Room {
+	return a.grid[coords]
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Names of the log streams kept in the store, for moderators to review.
+const (
+	streamCommands = "commands" // Every command players send
+	streamChat     = "chat"     // Everything said on each channel
+	streamAdmin    = "admin"    // Everything admins do with their powers
+	streamLogins   = "logins"   // Logins and logouts
+)
+
+// The streams, as listed to admins.
+var auditStreams = []string{streamCommands, streamChat, streamAdmin, streamLogins}
+
+// Most log entries shown by one search with the logs command.
+const maxLogResults = 50
+
+// Appends an entry to one of the log streams, about player. Failures are
+// logged, but don't stop whatever is being logged.
+func audit(stream, player, format string, args ...interface{}) {
+	err := store.AppendLog(LogEntry{
+		Time:    world.clock.Now(),
+		Stream:  stream,
+		Player:  player,
+		Message: fmt.Sprintf(format, args...),
+	})
+	if err != nil {
+		log.WithError(err).WithField("stream", stream).Error("Could not write to log stream.")
+	}
+}
+
+func isAuditStream(stream string) bool {
+	for _, known := range auditStreams {
+		if stream == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Lets admins search the log streams for what a player has been up to:
+//
+//	logs <player>            - the player's most recent entries in every stream
+//	logs <player> <stream>   - just those in one stream, e.g. chat
+func logsCommand() Command {
+	return Command{
+		names: []string{"logs"},
+		action: func(p *Mob, args string) ReadiedCommand {
+			return func() bool {
+				if !p.admin {
+					p.tell("Only admins can read the logs.\n")
+					return false
+				}
+				fields := strings.Fields(args)
+				player, stream := "", ""
+				if len(fields) == 2 {
+					stream = strings.ToLower(fields[1])
+				}
+				if len(fields) > 0 {
+					player = fields[0]
+				}
+				if player == "" || len(fields) > 2 || stream != "" && !isAuditStream(stream) {
+					p.tell("Use 'logs <player>' or 'logs <player> <stream>', where the streams are " +
+						strings.Join(auditStreams, ", ") + ".\n")
+					return false
+				}
+				entries, err := store.ReadLogs(stream, player)
+				if err != nil {
+					log.WithError(err).Error("Could not read the logs.")
+					p.tell("The logs could not be read.\n")
+					return false
+				}
+				audit(streamAdmin, p.name, "Searched the logs for '%v' in '%v'.", player, stream)
+				if len(entries) == 0 {
+					p.tell(fmt.Sprintf("There's nothing in the logs for %v.\n", player))
+					return true
+				}
+				if len(entries) > maxLogResults {
+					entries = entries[len(entries)-maxLogResults:]
+				}
+				output := fmt.Sprintf("The last %v log entries for %v:\n", len(entries), player)
+				for _, entry := range entries {
+					output += fmt.Sprintf("%v [%v] %v\n", entry.Time.Format("2006-01-02 15:04:05"), entry.Stream, escapeMarkup(entry.Message))
+				}
+				p.tell(output)
+				return true
+			}
+		},
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Symbols used when drawing an Area.
+const (
+	mapSymbolPlayer    = "@"
+	mapSymbolVisited   = "o"
+	mapSymbolUnvisited = "#"
+	mapSymbolEastWest  = "-"
+	mapSymbolNorthSth  = "|"
+)
+
+// The most rows of the area shown by the 'map' command, before 'map full'.
+const minimapRows = 11
+
+func mapCommand() Command {
+	return Command{
+		names: []string{"map", "m"},
+		action: func(p *Mob, args string) ReadiedCommand {
+			return func() bool {
+				area := p.location.area
+				if area == nil {
+					p.tell("You can't make out your surroundings.\n")
+					return false
+				}
+				if strings.EqualFold(strings.TrimSpace(args), "full") {
+					p.tell(area.render(p, Coordinates{0, 0}, area.width, area.height, p.builder))
+					return true
+				}
+				width := p.textWidth()
+				// Leave room for the frame around the map.
+				cols := clamp(width-2, 1, area.width)
+				rows := clamp(minimapRows, 1, area.height)
+				origin := Coordinates{
+					clamp(p.location.coords.x-cols/2, 0, area.width-cols),
+					clamp(p.location.coords.y-rows/2, 0, area.height-rows),
+				}
+				p.tell(area.render(p, origin, cols, rows, false))
+				return true
+			}
+		},
+	}
+}
+
+// Restricts n to the range [low, high].
+func clamp(n, low, high int) int {
+	if n > high {
+		n = high
+	}
+	if n < low {
+		n = low
+	}
+	return n
+}
+
+// Draws the cols by rows section of the Area whose top left corner is at
+// origin, as seen by Mob m. Unless reveal is set, only the Rooms m has
+// visited and those it has seen an exit to are drawn.
+func (a *Area) render(m *Mob, origin Coordinates, cols, rows int, reveal bool) string {
+	var output strings.Builder
+	border := "+" + strings.Repeat("-", cols) + "+\n"
+	output.WriteString(border)
+	for y := origin.y; y < origin.y+rows; y++ {
+		output.WriteString("|")
+		for x := origin.x; x < origin.x+cols; x++ {
+			output.WriteString(a.symbolAt(m, Coordinates{x, y}, reveal))
+		}
+		output.WriteString("|\n")
+	}
+	output.WriteString(border)
+	output.WriteString(fmt.Sprintf("%v you  %v visited  %v unvisited\n",
+		mapSymbolPlayer, mapSymbolVisited, mapSymbolUnvisited))
+	return output.String()
+}
+
+// Works out what to draw at coords. Rooms are drawn according to whether m
+// is in them or has visited them, and the space between two Rooms shows
+// whether there is an exit joining them.
+func (a *Area) symbolAt(m *Mob, coords Coordinates, reveal bool) string {
+	if room := a.roomAt(coords); room != nil {
+		switch {
+		case room == m.location:
+			return mapSymbolPlayer
+		case m.hasVisited(room):
+			return mapSymbolVisited
+		case reveal || a.seenFrom(m, room):
+			return mapSymbolUnvisited
+		}
+		return " "
+	}
+	west := a.roomAt(Coordinates{coords.x - 1, coords.y})
+	east := a.roomAt(Coordinates{coords.x + 1, coords.y})
+	if west != nil && east != nil && west.leadsTo(east) && (reveal || m.hasVisited(west) || m.hasVisited(east)) {
+		return mapSymbolEastWest
+	}
+	north := a.roomAt(Coordinates{coords.x, coords.y - 1})
+	south := a.roomAt(Coordinates{coords.x, coords.y + 1})
+	if north != nil && south != nil && north.leadsTo(south) && (reveal || m.hasVisited(north) || m.hasVisited(south)) {
+		return mapSymbolNorthSth
+	}
+	return " "
+}
+
+// Returns true if m has visited a Room with an exit leading to room.
+func (a *Area) seenFrom(m *Mob, room *Room) bool {
+	for _, exit := range room.exits {
+		if m.hasVisited(exit.getDestination()) {
+			return true
+		}
+	}
+	return false
+}
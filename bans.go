@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Ban is the serialised format of an address that isn't allowed to connect.
+type Ban struct {
+	Address string    `yaml:"address"` // An IP address, or a block of them in CIDR notation
+	Reason  string    `yaml:"reason"`
+	By      string    `yaml:"by"` // Name of the admin who made the ban
+	Time    time.Time `yaml:"time"`
+}
+
+// Returns true if the ban covers ip.
+func (b Ban) matches(ip net.IP) bool {
+	if _, block, err := net.ParseCIDR(b.Address); err == nil {
+		return block.Contains(ip)
+	}
+	banned := net.ParseIP(b.Address)
+	return banned != nil && banned.Equal(ip)
+}
+
+// The bans in force, loaded from the store at startup.
+var (
+	bans     []Ban
+	bansLock sync.Mutex
+)
+
+// Loads the ban list from the store.
+func loadBans() error {
+	loaded, err := store.LoadBans()
+	if err != nil {
+		return err
+	}
+	bansLock.Lock()
+	defer bansLock.Unlock()
+	bans = loaded
+	log.WithField("no_bans", len(bans)).Info("Bans loaded.")
+	return nil
+}
+
+// Returns the ban covering the address addr, if there is one.
+func findBan(addr net.Addr) (Ban, bool) {
+	ip := addressIP(addr)
+	if ip == nil {
+		return Ban{}, false
+	}
+	bansLock.Lock()
+	defer bansLock.Unlock()
+	for _, ban := range bans {
+		if ban.matches(ip) {
+			return ban, true
+		}
+	}
+	return Ban{}, false
+}
+
+// Returns the IP address of addr, or nil if it doesn't have one.
+func addressIP(addr net.Addr) net.IP {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// Changes the ban list with change, then saves it.
+func updateBans(change func([]Ban) []Ban) error {
+	bansLock.Lock()
+	defer bansLock.Unlock()
+	changed := change(append([]Ban{}, bans...))
+	if err := store.SaveBans(changed); err != nil {
+		return err
+	}
+	bans = changed
+	return nil
+}
+
+// Lets admins manage the ban list:
+//
+//	ban                      - list the bans
+//	ban <address> [reason]   - ban an IP address or CIDR block, dropping anyone connected from it
+func banCommand() Command {
+	return Command{
+		names: []string{"ban"},
+		action: func(p *Mob, args string) ReadiedCommand {
+			return func() bool {
+				if !p.admin {
+					p.tell("Only admins can ban players.\n")
+					return false
+				}
+				address, reason, _ := strings.Cut(strings.TrimSpace(args), " ")
+				if address == "" {
+					p.tell(describeBans())
+					return true
+				}
+				if !validBanAddress(address) {
+					p.tell(fmt.Sprintf("'%v' isn't an IP address or CIDR block.\n", address))
+					return false
+				}
+				err := updateBans(func(current []Ban) []Ban {
+					for i, ban := range current {
+						if ban.Address == address {
+							current = append(current[:i], current[i+1:]...)
+							break
+						}
+					}
+					return append(current, Ban{Address: address, Reason: strings.TrimSpace(reason), By: p.name, Time: world.clock.Now()})
+				})
+				if err != nil {
+					log.WithError(err).Error("Could not save bans.")
+					p.tell("The ban list could not be saved, please try again later.\n")
+					return false
+				}
+				log.WithFields(log.Fields{"address": address, "admin": p.name}).Warn("Address banned.")
+				audit(streamAdmin, p.name, "Banned %v: %v", address, reason)
+				p.tell(fmt.Sprintf("Banned %v. %v players dropped.\n", address, dropBanned()))
+				return true
+			}
+		},
+	}
+}
+
+// Lets admins lift a ban with 'unban <address>'.
+func unbanCommand() Command {
+	return Command{
+		names: []string{"unban"},
+		action: func(p *Mob, args string) ReadiedCommand {
+			return func() bool {
+				if !p.admin {
+					p.tell("Only admins can lift bans.\n")
+					return false
+				}
+				address := strings.TrimSpace(args)
+				found := false
+				err := updateBans(func(current []Ban) []Ban {
+					for i, ban := range current {
+						if ban.Address == address {
+							found = true
+							return append(current[:i], current[i+1:]...)
+						}
+					}
+					return current
+				})
+				switch {
+				case err != nil:
+					log.WithError(err).Error("Could not save bans.")
+					p.tell("The ban list could not be saved, please try again later.\n")
+					return false
+				case !found:
+					p.tell(fmt.Sprintf("%v isn't banned.\n", address))
+					return false
+				}
+				log.WithFields(log.Fields{"address": address, "admin": p.name}).Warn("Ban lifted.")
+				audit(streamAdmin, p.name, "Lifted the ban on %v.", address)
+				p.tell(fmt.Sprintf("Lifted the ban on %v.\n", address))
+				return true
+			}
+		},
+	}
+}
+
+// Returns true if address is an IP address or a CIDR block.
+func validBanAddress(address string) bool {
+	if net.ParseIP(address) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(address)
+	return err == nil
+}
+
+// Disconnects every player connected from a banned address, returning how
+// many there were.
+func dropBanned() (dropped int) {
+	usersLock.Lock()
+	banned := []*User{}
+	for _, user := range users {
+		if _, found := findBan(user.Conn.RemoteAddr()); found {
+			banned = append(banned, user)
+		}
+	}
+	usersLock.Unlock()
+	for _, user := range banned {
+		u, m := user, user.Mob
+		// Each player is logged out on their own Mob's beat, as it may be in
+		// the middle of a command. If its queue is full, their connection is
+		// dropped instead.
+		if !m.enqueue(func() bool {
+			u.write("You have been banned from this server.\n")
+			m.logout()
+			disconnectUserFromMob(m)
+			return true
+		}) {
+			u.Conn.Close()
+		}
+		u.disconnecting.Store(true)
+	}
+	return len(banned)
+}
+
+func describeBans() string {
+	bansLock.Lock()
+	defer bansLock.Unlock()
+	if len(bans) == 0 {
+		return "No one is banned.\n"
+	}
+	output := "Bans:\n"
+	for _, ban := range bans {
+		output += fmt.Sprintf("  %-18v by %v on %v: %v\n", ban.Address, ban.By, ban.Time.Format("2006-01-02"), ban.Reason)
+	}
+	return output
+}
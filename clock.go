@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is where the World gets the time from, and what runs its beat and
+// its timers. The server runs on the real clock; the harness uses a
+// manualClock, which only moves when it's told to, so that everything timed
+// happens on the same beat every run.
+type Clock interface {
+	Now() time.Time
+	// Blocks until d has passed.
+	Sleep(d time.Duration)
+	// Calls f once d has passed, unless the Timer is stopped first.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a call waiting on a Clock.
+type Timer interface {
+	// Stops the call, returning false if it has already been made or
+	// stopped.
+	Stop() bool
+}
+
+// realClock is the time as the server's machine knows it.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// manualClock is a Clock that stands still until it's advanced. Timers that
+// come due are called one after another by whoever advances it, in the
+// order they're due, so nothing happens behind the caller's back.
+type manualClock struct {
+	sync.Mutex
+	now    time.Time
+	timers []*manualTimer // Waiting to be called, in the order they're due
+	added  int            // Timers added so far, to order those due at once
+}
+
+func newManualClock(start time.Time) *manualClock {
+	return &manualClock{now: start}
+}
+
+func (mc *manualClock) Now() time.Time {
+	mc.Lock()
+	defer mc.Unlock()
+	return mc.now
+}
+
+// Blocks until someone else advances the clock by d.
+func (mc *manualClock) Sleep(d time.Duration) {
+	woken := make(chan bool)
+	mc.AfterFunc(d, func() { close(woken) })
+	<-woken
+}
+
+func (mc *manualClock) AfterFunc(d time.Duration, f func()) Timer {
+	mc.Lock()
+	defer mc.Unlock()
+	mc.added++
+	timer := &manualTimer{clock: mc, due: mc.now.Add(d), order: mc.added, call: f}
+	mc.timers = append(mc.timers, timer)
+	sort.Slice(mc.timers, func(i, j int) bool {
+		if !mc.timers[i].due.Equal(mc.timers[j].due) {
+			return mc.timers[i].due.Before(mc.timers[j].due)
+		}
+		return mc.timers[i].order < mc.timers[j].order
+	})
+	return timer
+}
+
+// Moves the clock on by d, calling each timer as the clock reaches it.
+// Timers set by those calls are called too, if they come due within d.
+func (mc *manualClock) advance(d time.Duration) {
+	mc.Lock()
+	until := mc.now.Add(d)
+	for len(mc.timers) > 0 && !mc.timers[0].due.After(until) {
+		timer := mc.timers[0]
+		mc.timers = mc.timers[1:]
+		if timer.due.After(mc.now) {
+			mc.now = timer.due
+		}
+		mc.Unlock()
+		timer.call()
+		mc.Lock()
+	}
+	mc.now = until
+	mc.Unlock()
+}
+
+// manualTimer is a call waiting on a manualClock.
+type manualTimer struct {
+	clock *manualClock
+	due   time.Time
+	order int
+	call  func()
+}
+
+func (mt *manualTimer) Stop() bool {
+	mt.clock.Lock()
+	defer mt.clock.Unlock()
+	for i, timer := range mt.clock.timers {
+		if timer == mt {
+			mt.clock.timers = append(mt.clock.timers[:i], mt.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClockCallsTimersInOrder(t *testing.T) {
+	clock := newManualClock(harnessEpoch)
+	called := []string{}
+	clock.AfterFunc(2*time.Second, func() { called = append(called, "second") })
+	clock.AfterFunc(time.Second, func() {
+		called = append(called, "first")
+		clock.AfterFunc(time.Second, func() { called = append(called, "chained") })
+	})
+	stopped := clock.AfterFunc(time.Second, func() { called = append(called, "stopped") })
+	if !stopped.Stop() {
+		t.Error("Stopping a waiting timer returned false.")
+	}
+	clock.advance(1500 * time.Millisecond)
+	if len(called) != 1 || called[0] != "first" {
+		t.Fatalf("Called %v after 1.5s, want just first.", called)
+	}
+	clock.advance(time.Second)
+	if len(called) != 3 || called[1] != "second" || called[2] != "chained" {
+		t.Errorf("Called %v after 2.5s, want first, second, chained.", called)
+	}
+	if want := harnessEpoch.Add(2500 * time.Millisecond); !clock.Now().Equal(want) {
+		t.Errorf("Clock read %v, want %v.", clock.Now(), want)
+	}
+}
+
+func TestRecordsAreStampedByTheWorldsClock(t *testing.T) {
+	h, err := newHarness("testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	h.step(10)
+	now := h.clock.Now()
+	s := h.connectAs("alice")
+	if err := store.SaveAccount(Account{Name: "alice", Admin: true}); err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+	s = h.connectAs("alice")
+	if err := s.expect("ban 10.0.0.1 Testing.", "Banned 10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := store.ReadLogs(streamLogins, "alice")
+	if err != nil || len(entries) == 0 {
+		t.Fatalf("Read log entries %v, %v.", entries, err)
+	}
+	if !entries[0].Time.Equal(now) {
+		t.Errorf("Login was logged at %v, want %v.", entries[0].Time, now)
+	}
+	bans, err := store.LoadBans()
+	if err != nil || len(bans) != 1 {
+		t.Fatalf("Loaded bans %v, %v.", bans, err)
+	}
+	if bans[0].Time.Before(harnessEpoch) || bans[0].Time.After(h.clock.Now()) {
+		t.Errorf("Ban was made at %v, outside the harness's time.", bans[0].Time)
+	}
+	if saved := world.snapshot().Saved; !saved.Equal(h.clock.Now()) {
+		t.Errorf("Snapshot was saved at %v, want %v.", saved, h.clock.Now())
+	}
+}
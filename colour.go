@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ANSI escape codes for each colour in the markup language. Lower case
+// letters are normal colours, upper case are bright ones, and {x} resets.
+var colourCodes = map[string]string{
+	"x": "\x1b[0m",
+	"d": "\x1b[30m", "D": "\x1b[1;30m",
+	"r": "\x1b[31m", "R": "\x1b[1;31m",
+	"g": "\x1b[32m", "G": "\x1b[1;32m",
+	"y": "\x1b[33m", "Y": "\x1b[1;33m",
+	"b": "\x1b[34m", "B": "\x1b[1;34m",
+	"m": "\x1b[35m", "M": "\x1b[1;35m",
+	"c": "\x1b[36m", "C": "\x1b[1;36m",
+	"w": "\x1b[37m", "W": "\x1b[1;37m",
+}
+
+// The parts of the game's output whose colour players can choose, and the
+// colours they have unless a player picks otherwise.
+var defaultTheme = map[string]string{
+	"title":  "C",
+	"exits":  "g",
+	"speech": "y",
+}
+
+// Colour modes a player can choose between.
+const (
+	colourAuto = "auto" // Colour if the client says it's a terminal that can show it
+	colourOn   = "on"
+	colourOff  = "off"
+)
+
+// Turns colour markup in text into ANSI escape codes, or removes it if ansi
+// is false. Markup is either a colour, e.g. {R}, or the name of a part of
+// the output, e.g. {title}, which is coloured according to theme. {{ is a
+// literal brace, and anything else in braces is left alone.
+func renderMarkup(text string, ansi bool, theme map[string]string) string {
+	var output strings.Builder
+	coloured := false // Whether a colour is still in effect
+	for {
+		start := strings.IndexByte(text, '{')
+		if start < 0 {
+			output.WriteString(text)
+			break
+		}
+		output.WriteString(text[:start])
+		text = text[start:]
+		if strings.HasPrefix(text, "{{") {
+			output.WriteByte('{')
+			text = text[2:]
+			continue
+		}
+		end := strings.IndexByte(text, '}')
+		if end < 0 {
+			output.WriteString(text)
+			break
+		}
+		code, ok := markupCode(text[1:end], theme)
+		if !ok {
+			output.WriteByte('{')
+			text = text[1:]
+			continue
+		}
+		if ansi {
+			output.WriteString(code)
+			coloured = code != colourCodes["x"]
+		}
+		text = text[end+1:]
+	}
+	// Stop colour bleeding into whatever is sent next.
+	if coloured {
+		output.WriteString(colourCodes["x"])
+	}
+	return output.String()
+}
+
+// Returns the escape code for a single piece of markup, looking up parts of
+// the output in theme and then the default theme.
+func markupCode(token string, theme map[string]string) (string, bool) {
+	if code, ok := colourCodes[token]; ok {
+		return code, true
+	}
+	if _, ok := defaultTheme[token]; ok {
+		colour, chosen := theme[token]
+		if !chosen {
+			colour = defaultTheme[token]
+		}
+		return colourCodes[colour], true
+	}
+	return "", false
+}
+
+// Removes colour markup from text, e.g. to find how wide it will be on
+// screen.
+func stripMarkup(text string) string {
+	return renderMarkup(text, false, nil)
+}
+
+// Escapes braces in text that shouldn't be read as markup.
+func escapeMarkup(text string) string {
+	return strings.ReplaceAll(text, "{", "{{")
+}
+
+// Returns true if a user should be sent colour, given their chosen mode and
+// whether their client has said it can show it.
+func wantsColour(mode string, clientANSI bool) bool {
+	switch mode {
+	case colourOn:
+		return true
+	case colourOff:
+		return false
+	}
+	return clientANSI
+}
+
+// Lets players choose whether they see colour and which colours are used:
+//
+//	colour                          - show current settings
+//	colour on|off|auto              - turn colour on or off, or leave it to the client
+//	colour theme <part> <colour>    - colour a part of the output, e.g. colour theme title R
+//	colour theme <part> default     - go back to the default colour for a part
+func colourCommand() Command {
+	return Command{
+		names: []string{"colour", "color"},
+		action: func(p *Mob, args string) ReadiedCommand {
+			return func() bool {
+				fields := strings.Fields(args)
+				switch {
+				case len(fields) == 0:
+					p.tell(p.describeColour())
+					return true
+				case len(fields) == 1 && (fields[0] == colourAuto || fields[0] == colourOn || fields[0] == colourOff):
+					p.updatePreferences(func(prefs *Preferences) {
+						prefs.Colour = fields[0]
+					})
+					p.tell(fmt.Sprintf("Colour is now %v.\n", fields[0]))
+					return true
+				case len(fields) == 3 && fields[0] == "theme":
+					part, colour := strings.ToLower(fields[1]), fields[2]
+					if _, ok := defaultTheme[part]; !ok {
+						p.tell(fmt.Sprintf("You can't colour '%v'.\n", part))
+						return false
+					}
+					if _, ok := colourCodes[colour]; !ok && colour != "default" {
+						p.tell(fmt.Sprintf("'%v' isn't a colour.\n", colour))
+						return false
+					}
+					p.updatePreferences(func(prefs *Preferences) {
+						if colour == "default" {
+							delete(prefs.Theme, part)
+							return
+						}
+						if prefs.Theme == nil {
+							prefs.Theme = make(map[string]string)
+						}
+						prefs.Theme[part] = colour
+					})
+					p.tell(fmt.Sprintf("{%v}This is how %v will look.{x}\n", part, part))
+					return true
+				}
+				p.tell("Use 'colour on', 'colour off', 'colour auto' or 'colour theme <part> <colour>'.\n")
+				return false
+			}
+		},
+	}
+}
+
+// Describes the Mob's colour settings, with a sample of each colour.
+func (m *Mob) describeColour() string {
+	prefs := m.getPreferences()
+	mode := prefs.Colour
+	if mode == "" {
+		mode = colourAuto
+	}
+	codes := []string{}
+	for code := range colourCodes {
+		if code != "x" {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	samples := []string{}
+	for _, code := range codes {
+		samples = append(samples, fmt.Sprintf("{%v}%v{x}", code, code))
+	}
+	parts := []string{}
+	for part := range defaultTheme {
+		parts = append(parts, part)
+	}
+	sort.Strings(parts)
+	output := fmt.Sprintf("Colour: %v\nColours: %v\nTheme:\n", mode, strings.Join(samples, " "))
+	for _, part := range parts {
+		colour, ok := prefs.Theme[part]
+		if !ok {
+			colour = defaultTheme[part] + " (default)"
+		}
+		output += fmt.Sprintf("  {%v}%-8v{x} %v\n", part, part, colour)
+	}
+	return output
+}
@@ -2,14 +2,16 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
 type Cmd = func(*Mob, string) ReadiedCommand
 
 type Command struct {
-	names  []string
-	action Cmd
+	names     []string
+	action    Cmd
+	immediate bool // Immediate commands run as soon as they're entered, instead of waiting in the queue
 }
 
 type ReadiedCommand = func() bool
@@ -19,7 +21,7 @@ func lookCommand() Command {
 		names: []string{"look", "l"},
 		action: func(p *Mob, _ string) ReadiedCommand {
 			return func() bool {
-				p.print <- p.location.displayRoom()
+				p.tell(p.location.displayRoom(p.textWidth()))
 				return true
 			}
 		},
@@ -31,7 +33,7 @@ func exitCommand() Command {
 		names: []string{"exits", "doors", "dirs"},
 		action: func(p *Mob, _ string) ReadiedCommand {
 			return func() bool {
-				p.print <- p.location.listExits()
+				p.tell(p.location.listExits())
 				return true
 			}
 		},
@@ -43,7 +45,7 @@ func quitCommand() Command {
 		names: []string{"quit", "q"},
 		action: func(p *Mob, _ string) ReadiedCommand {
 			return func() bool {
-				p.despawn()
+				p.logout()
 				disconnectUserFromMob(p)
 				return true
 			}
@@ -56,7 +58,123 @@ func sayCommand() Command {
 		names: []string{"say", "'"},
 		action: func(p *Mob, text string) ReadiedCommand {
 			return func() bool {
-				world.roomEmit(fmt.Sprintf("%v says: %v\n", p.getName(), text), p.location)
+				world.roomEmit(fmt.Sprintf("{speech}%v says: %v{x}\n", p.getName(), text), p.location)
+				roomChannelGMCP("say", p.getName(), text, p.location)
+				audit(streamChat, p.getName(), "[say in %v] %v", p.location.id, text)
+				return true
+			}
+		},
+	}
+}
+
+func openCommand() Command {
+	return Command{
+		names: []string{"open"},
+		action: func(p *Mob, direction string) ReadiedCommand {
+			return func() bool {
+				return p.setDoor(direction, false)
+			}
+		},
+	}
+}
+
+func closeCommand() Command {
+	return Command{
+		names: []string{"close"},
+		action: func(p *Mob, direction string) ReadiedCommand {
+			return func() bool {
+				return p.setDoor(direction, true)
+			}
+		},
+	}
+}
+
+func pathCommand() Command {
+	return Command{
+		names: []string{"path"},
+		action: func(p *Mob, target string) ReadiedCommand {
+			return func() bool {
+				path, err := p.pathTo(target)
+				if err != nil {
+					p.tell(err.Error() + "\n")
+					return false
+				}
+				p.tell(fmt.Sprintf("The way there is: %v\n", describePath(path)))
+				return true
+			}
+		},
+	}
+}
+
+func travelCommand() Command {
+	return Command{
+		names: []string{"travel", "run"},
+		action: func(p *Mob, target string) ReadiedCommand {
+			return func() bool {
+				path, err := p.pathTo(target)
+				if err != nil {
+					p.tell(err.Error() + "\n")
+					return false
+				}
+				if !p.follow(path) {
+					p.tell("That's too far to travel in one go.\n")
+					return false
+				}
+				p.tell(fmt.Sprintf("You set off: %v\n", describePath(path)))
+				return true
+			}
+		},
+	}
+}
+
+func stopCommand() Command {
+	return Command{
+		names:     []string{"stop"},
+		immediate: true,
+		action: func(p *Mob, _ string) ReadiedCommand {
+			return func() bool {
+				if p.clearQueue() > 0 {
+					p.tell("You stop what you were doing.\n")
+				} else {
+					p.tell("You aren't doing anything.\n")
+				}
+				return true
+			}
+		},
+	}
+}
+
+func scoreCommand() Command {
+	return Command{
+		names: []string{"score", "sc"},
+		action: func(p *Mob, _ string) ReadiedCommand {
+			return func() bool {
+				p.tell(fmt.Sprintf("You are %v.\n%v", p.getName(), p.explorationReport()))
+				return true
+			}
+		},
+	}
+}
+
+// Lists the players in the game.
+func whoCommand() Command {
+	return Command{
+		names: []string{"who"},
+		action: func(p *Mob, _ string) ReadiedCommand {
+			return func() bool {
+				usersLock.Lock()
+				mobs := []*Mob{}
+				for _, user := range users {
+					mobs = append(mobs, user.Mob)
+				}
+				usersLock.Unlock()
+				mobs = append(mobs, linkdeadList()...)
+				sort.Slice(mobs, func(i, j int) bool { return mobs[i].name < mobs[j].name })
+				output := "Players in the game:\n"
+				for _, mob := range mobs {
+					output += fmt.Sprintf("  %v%v\n", mob.name, mob.statusTags())
+				}
+				p.tell(output + fmt.Sprintf("%v players.\n", len(mobs)))
 				return true
 			}
 		},
@@ -65,7 +183,7 @@ func sayCommand() Command {
 
 func noCommandAction(p *Mob, _ string) ReadiedCommand {
 	return func() bool {
-		p.print <- "I don't know how to do that!\n"
+		p.tell("I don't know how to do that!\n")
 		return true
 	}
 }
@@ -73,34 +191,54 @@ func noCommandAction(p *Mob, _ string) ReadiedCommand {
 func generateExitAction(exit *Exit) Cmd {
 	return func(m *Mob, _ string) ReadiedCommand {
 		return func() bool {
+			if m.location != exit.room {
+				m.tell("You can't go that way from here.\n")
+				return false
+			}
+			if !exit.isOpen() {
+				m.tell(fmt.Sprintf("The way %v is closed.\n", exit.getPrimaryName()))
+				return false
+			}
 			roomLeft := exit.room.leaveRoom(m)
 			if !roomLeft {
-				m.print <- "You can't get out of here!"
+				m.tell("You can't get out of here!")
 			}
 			world.roomEmit(fmt.Sprintf("%v leaves to the %v.\n", m.name, exit.getPrimaryName()), exit.room)
 			roomEntered := exit.destination.room.enterRoom(m)
 			if !roomEntered {
-				m.print <- "You can't get in there!"
+				m.tell("You can't get in there!")
 			}
 			world.roomEmit(fmt.Sprintf("%v enters from the %v.\n", m.name, exit.destination.getPrimaryName()), exit.destination.room)
-			m.print <- exit.destination.room.displayRoom()
+			m.tell(exit.destination.room.displayRoom(m.textWidth()))
 			return roomEntered
 		}
 	}
 }
 
 func basicCommands() (output []Command) {
-	output = append(output, []Command{lookCommand(), exitCommand(), quitCommand(), sayCommand()}...)
+	output = append(output, []Command{lookCommand(), exitCommand(), quitCommand(), sayCommand(), mapCommand(), scoreCommand(),
+		openCommand(), closeCommand(), pathCommand(), travelCommand(), stopCommand(),
+		motdCommand(), newsCommand(), screenCommand(), colourCommand(),
+		widthCommand(), pagerCommand(), promptCommand(), sshKeyCommand(),
+		compressionCommand(), whoCommand(), banCommand(), unbanCommand(), logsCommand()}...)
 	return
 }
 
 func readyCommand(firstPart string, commands []Command) Cmd {
+	if cmd, found := findCommand(firstPart, commands); found {
+		return cmd.action
+	}
+	return noCommandAction
+}
+
+// Finds the Command with an alias matching firstPart.
+func findCommand(firstPart string, commands []Command) (Command, bool) {
 	for _, cmd := range commands {
 		for _, alias := range cmd.names {
 			if strings.ToLower(alias) == strings.ToLower(firstPart) {
-				return cmd.action
+				return cmd, true
 			}
 		}
 	}
-	return noCommandAction
+	return Command{}, false
 }
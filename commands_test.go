@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// commandStep is a line typed by one of the players in a commandTest, and
+// what its output should and shouldn't contain.
+type commandStep struct {
+	player string // alice or bob
+	line   string
+	want   []string
+	not    []string
+}
+
+// commandTest is a script played by alice and bob, who start out together
+// in the Atrium of testmap.
+type commandTest struct {
+	name  string
+	steps []commandStep
+}
+
+var commandTests = []commandTest{
+	{"look", []commandStep{
+		{"alice", "look", []string{"|The Atrium of Anubis|", "A mighty atrium.", "- alice", "- bob", "Visible Exits: East, South"}, nil},
+		{"alice", "l", []string{"|The Atrium of Anubis|"}, nil},
+	}},
+	{"exits", []commandStep{
+		{"alice", "exits", []string{"Visible Exits: East, South"}, []string{"|The Atrium of Anubis|"}},
+		{"alice", "e", nil, nil},
+		{"alice", "exits", []string{"West, East, South (closed)"}, nil},
+	}},
+	{"movement", []commandStep{
+		{"alice", "e", []string{"alice leaves to the East.", "|The Boardroom of Baldur|"}, nil},
+		{"bob", "", []string{"alice leaves to the East."}, []string{"Boardroom"}},
+		{"alice", "w", []string{"|The Atrium of Anubis|", "- bob"}, nil},
+		{"bob", "", []string{"alice enters from the East."}, nil},
+		{"alice", "n", []string{"I don't know how to do that!"}, []string{"leaves"}},
+		{"alice", "south", []string{"|The Cattery|"}, nil},
+	}},
+	{"doors", []commandStep{
+		{"alice", "e", nil, nil},
+		{"alice", "s", []string{"The way South is closed."}, []string{"|The Dungeon|"}},
+		{"alice", "open w", []string{"There's no door to the West."}, nil},
+		{"alice", "open up", []string{"There's no exit that way to open."}, nil},
+		{"alice", "open s", []string{"alice opens the door to the South."}, nil},
+		{"alice", "open s", []string{"The door to the South is already open."}, nil},
+		{"alice", "s", []string{"|The Dungeon|", "North, West, East"}, nil},
+		{"alice", "close n", []string{"alice closes the door to the North."}, nil},
+		{"alice", "n", []string{"The way North is closed."}, nil},
+	}},
+	{"path", []commandStep{
+		{"alice", "path cattery", []string{"You don't know of anywhere called 'cattery'."}, nil},
+		{"alice", "s", nil, nil},
+		{"alice", "n", nil, nil},
+		{"alice", "e", nil, nil},
+		{"alice", "path cattery", []string{"The way there is: West, South"}, nil},
+		{"alice", "path boardroom", []string{"You're already there."}, nil},
+		{"alice", "path", []string{"Where do you want to go?"}, nil},
+	}},
+	{"travel", []commandStep{
+		{"alice", "s", nil, nil},
+		{"alice", "n", nil, nil},
+		{"alice", "e", nil, nil},
+		{"alice", "travel cattery", []string{"You set off: West, South", "|The Atrium of Anubis|", "|The Cattery|"}, nil},
+		{"alice", "run nowhere", []string{"You don't know of anywhere called 'nowhere'."}, nil},
+	}},
+	{"speedwalk", []commandStep{
+		{"alice", "s e", []string{"|The Cattery|", "|The Dungeon|"}, nil},
+		{"alice", "w n", []string{"|The Cattery|", "|The Atrium of Anubis|"}, nil},
+		{"alice", "e 2w", []string{"|The Boardroom of Baldur|", "|The Atrium of Anubis|", "You can't go West from here."}, nil},
+		{"alice", "see", []string{"I don't know how to do that!"}, []string{"leaves"}},
+	}},
+	{"say", []commandStep{
+		{"alice", "say hello there", []string{"alice says: hello there"}, nil},
+		{"bob", "", []string{"alice says: hello there"}, nil},
+		{"bob", "e", nil, nil},
+		{"alice", "' anyone?", []string{"alice says: anyone?"}, nil},
+		{"bob", "", nil, []string{"anyone?"}},
+	}},
+	{"who", []commandStep{
+		{"alice", "who", []string{"Players in the game:", "  alice\n", "  bob\n", "2 players."}, nil},
+	}},
+	{"quit", []commandStep{
+		{"alice", "quit", nil, nil},
+		{"bob", "", []string{"alice departs from the game."}, nil},
+		{"bob", "who", []string{"  bob\n", "1 players."}, []string{"alice"}},
+		{"bob", "look", nil, []string{"- alice"}},
+	}},
+}
+
+func TestCommands(t *testing.T) {
+	for _, test := range commandTests {
+		t.Run(test.name, func(t *testing.T) {
+			h, err := newHarness("testmap")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.close()
+			sessions := map[string]*Session{}
+			for _, name := range []string{"alice", "bob"} {
+				sessions[name] = h.connect()
+				if err := sessions[name].expect(name, "You shall be known as '"+name+"'"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sessions["alice"].output()
+			for i, step := range test.steps {
+				output, err := sessions[step.player].do(step.line)
+				if err != nil {
+					t.Fatalf("Step %v: %v", i+1, err)
+				}
+				for _, want := range step.want {
+					if !strings.Contains(output, want) {
+						t.Errorf("Step %v: output of %v's %q didn't contain %q, got:\n%v", i+1, step.player, step.line, want, output)
+					}
+				}
+				for _, not := range step.not {
+					if strings.Contains(output, not) {
+						t.Errorf("Step %v: output of %v's %q contained %q, got:\n%v", i+1, step.player, step.line, not, output)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the serialised format of the server's settings. Every setting
+// can also be given as a command-line flag, which takes precedence over the
+// config file.
+type Config struct {
+	Listen          listenAddrs   `yaml:"listen"`           // Addresses to accept telnet connections on
+	WebListen       string        `yaml:"web_listen"`       // Address to serve the browser client and WebSocket connections on, empty for none
+	SSHListen       string        `yaml:"ssh_listen"`       // Address to accept SSH connections on, empty for none
+	SSHHostKey      string        `yaml:"ssh_host_key"`     // File holding the SSH server's private key, created if missing
+	AdminListen     string        `yaml:"admin_listen"`     // Address to serve metrics, status and the admin API over HTTP on, empty for none
+	AdminToken      string        `yaml:"admin_token"`      // Bearer token the admin API needs, empty to turn the API off
+	WorldDir        string        `yaml:"world_dir"`        // Directory holding map.txt and rooms.txt
+	Tick            time.Duration `yaml:"tick"`             // How long each beat of the world lasts
+	Autosave        time.Duration `yaml:"autosave"`         // How often the world is saved, zero to turn autosave off
+	LogLevel        string        `yaml:"log_level"`        // One of logrus' levels, e.g. info
+	LogFormat       string        `yaml:"log_format"`       // text or json
+	ServerName      string        `yaml:"server_name"`      // Name of the game, shown on the connection screens
+	MOTDFile        string        `yaml:"motd_file"`        // File shown to players once they log in, instead of motd.txt in the world directory
+	MaxConnections  int           `yaml:"max_connections"`  // Most connections allowed at once, zero for no limit
+	MaxPerAddress   int           `yaml:"max_per_address"`  // Most connections allowed at once from one IP address, zero for no limit
+	CommandRate     float64       `yaml:"command_rate"`     // Commands a second each player can send, on average, zero for no limit
+	CommandBurst    int           `yaml:"command_burst"`    // Commands a player can send at once before the rate limit applies
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`     // How long a connection can go without sending anything, zero for no limit
+	AFKAfter        time.Duration `yaml:"afk_after"`        // How long a player can go without sending anything before being marked AFK, zero for never
+	LinkdeadTimeout time.Duration `yaml:"linkdead_timeout"` // How long a character stays in the world after its connection drops
+	RecordDir       string        `yaml:"record_dir"`       // Directory to record every session into, empty for none
+	Storage         StoreConfig   `yaml:"storage"`
+	MigrateFrom     string        `yaml:"-"` // Only ever given as a flag
+	Scrape          string        `yaml:"-"` // Only ever given as a flag
+	Replay          string        `yaml:"-"` // Only ever given as a flag
+}
+
+// StoreConfig selects the Store the server persists its data in.
+type StoreConfig struct {
+	Backend string `yaml:"backend"` // file or sqlite
+	Path    string `yaml:"path"`    // Empty for the backend's default
+}
+
+// listenAddrs is a list of addresses that can be given as a single,
+// comma-separated flag.
+type listenAddrs []string
+
+func (la *listenAddrs) String() string {
+	return strings.Join(*la, ",")
+}
+
+func (la *listenAddrs) Set(value string) error {
+	*la = strings.Split(value, ",")
+	return nil
+}
+
+func defaultConfig() Config {
+	return Config{
+		Listen:          listenAddrs{"0.0.0.0:8080"}, // Telnet default port
+		SSHHostKey:      "ssh_host_key",
+		WorldDir:        "testmap",
+		ServerName:      "the Telnet Game",
+		Tick:            time.Millisecond,
+		Autosave:        5 * time.Minute,
+		LinkdeadTimeout: 5 * time.Minute,
+		IdleTimeout:     time.Hour,
+		MaxPerAddress:   5,
+		CommandRate:     10,
+		CommandBurst:    20,
+		AFKAfter:        10 * time.Minute,
+		LogLevel:        "info",
+		LogFormat:       "text",
+		Storage:         StoreConfig{Backend: storeFile},
+	}
+}
+
+// Adds a flag for each setting to flags, writing into the Config.
+func (c *Config) bindFlags(flags *flag.FlagSet) {
+	flags.Var(&c.Listen, "listen", "Comma-separated addresses to accept telnet connections on.")
+	flags.StringVar(&c.WebListen, "web-listen", c.WebListen, "Address to serve the browser client and WebSocket connections on, empty for none.")
+	flags.StringVar(&c.SSHListen, "ssh-listen", c.SSHListen, "Address to accept SSH connections on, empty for none.")
+	flags.StringVar(&c.SSHHostKey, "ssh-host-key", c.SSHHostKey, "File holding the SSH server's private key, created if missing.")
+	flags.StringVar(&c.AdminListen, "admin-listen", c.AdminListen, "Address to serve metrics, status and the admin API over HTTP on, empty for none. Keep it private.")
+	flags.StringVar(&c.AdminToken, "admin-token", c.AdminToken, "Bearer token the admin API needs, empty to turn the API off.")
+	flags.StringVar(&c.WorldDir, "world", c.WorldDir, "Directory holding the world's map.txt and rooms.txt.")
+	flags.DurationVar(&c.Tick, "tick", c.Tick, "How long each beat of the world lasts.")
+	flags.DurationVar(&c.Autosave, "autosave", c.Autosave, "How often the world is saved, 0 to turn autosave off.")
+	flags.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Lowest level of log message to write, e.g. debug, info, warn.")
+	flags.StringVar(&c.LogFormat, "log-format", c.LogFormat, "Log format, 'text' or 'json'.")
+	flags.StringVar(&c.ServerName, "server-name", c.ServerName, "Name of the game, shown on the connection screens.")
+	flags.StringVar(&c.MOTDFile, "motd", c.MOTDFile, "File shown to players once they log in, instead of motd.txt in the world directory.")
+	flags.IntVar(&c.MaxConnections, "max-connections", c.MaxConnections, "Most connections allowed at once, 0 for no limit.")
+	flags.IntVar(&c.MaxPerAddress, "max-per-address", c.MaxPerAddress, "Most connections allowed at once from one IP address, 0 for no limit.")
+	flags.Float64Var(&c.CommandRate, "command-rate", c.CommandRate, "Commands a second each player can send, on average, 0 for no limit.")
+	flags.IntVar(&c.CommandBurst, "command-burst", c.CommandBurst, "Commands a player can send at once before the rate limit applies.")
+	flags.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "Disconnect connections idle for this long, 0 for no limit.")
+	flags.DurationVar(&c.AFKAfter, "afk-after", c.AFKAfter, "Mark players AFK once they've been idle for this long, 0 for never.")
+	flags.DurationVar(&c.LinkdeadTimeout, "linkdead-timeout", c.LinkdeadTimeout, "How long a character stays in the world after its connection drops, 0 to remove it straight away.")
+	flags.StringVar(&c.Storage.Backend, "storage", c.Storage.Backend, "Storage backend to use, 'file' or 'sqlite'.")
+	flags.StringVar(&c.Storage.Path, "storage-path", c.Storage.Path, "Where the storage backend keeps its data. Defaults to 'save' for file and 'save/game.db' for sqlite.")
+	flags.StringVar(&c.MigrateFrom, "migrate-from", c.MigrateFrom, "Copy everything from another storage backend, given as kind:path, into the one selected, then exit.")
+	flags.StringVar(&c.Scrape, "scrape", c.Scrape, "Scrape the metrics of the server whose admin endpoint is at this address, print them, then exit.")
+	flags.StringVar(&c.RecordDir, "record-dir", c.RecordDir, "Directory to record every session into, for replaying later, empty for none.")
+	flags.StringVar(&c.Replay, "replay", c.Replay, "Replay the session recorded in this file against a fresh copy of the world, print how its output differs, then exit.")
+}
+
+// Builds the server's Config from the command-line arguments args and the
+// config file they name, if any.
+func loadConfig(args []string) (Config, error) {
+	config := defaultConfig()
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	path := flags.String("config", "", "YAML file to read settings from.")
+	config.bindFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+	if *path != "" {
+		raw, err := os.ReadFile(*path)
+		if err != nil {
+			return config, err
+		}
+		if err := yaml.UnmarshalStrict(raw, &config); err != nil {
+			return config, fmt.Errorf("Could not parse config file '%v': %w", *path, err)
+		}
+		// Parse the flags again so that they override the file.
+		flags.Parse(args)
+	}
+	return config, config.validate()
+}
+
+// Checks that the Config's settings are usable, reporting all the problems
+// found at once.
+func (c *Config) validate() error {
+	problems := []error{}
+	if len(c.Listen) == 0 {
+		problems = append(problems, errors.New("at least one listen address is needed"))
+	}
+	for _, addr := range c.Listen {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			problems = append(problems, fmt.Errorf("bad listen address '%v': %w", addr, err))
+		}
+	}
+	if c.WebListen != "" {
+		if _, _, err := net.SplitHostPort(c.WebListen); err != nil {
+			problems = append(problems, fmt.Errorf("bad web listen address '%v': %w", c.WebListen, err))
+		}
+	}
+	if c.AdminListen != "" {
+		if _, _, err := net.SplitHostPort(c.AdminListen); err != nil {
+			problems = append(problems, fmt.Errorf("bad admin listen address '%v': %w", c.AdminListen, err))
+		}
+	}
+	if c.SSHListen != "" {
+		if _, _, err := net.SplitHostPort(c.SSHListen); err != nil {
+			problems = append(problems, fmt.Errorf("bad SSH listen address '%v': %w", c.SSHListen, err))
+		}
+		if c.SSHHostKey == "" {
+			problems = append(problems, errors.New("an SSH host key file is needed to listen for SSH"))
+		}
+	}
+	for _, file := range []string{"map.txt", "rooms.txt"} {
+		if _, err := os.Stat(filepath.Join(c.WorldDir, file)); err != nil {
+			problems = append(problems, fmt.Errorf("world directory is missing %v: %w", file, err))
+		}
+	}
+	if c.Tick <= 0 {
+		problems = append(problems, errors.New("tick must be positive"))
+	}
+	if c.Autosave < 0 {
+		problems = append(problems, errors.New("autosave can't be negative"))
+	}
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		problems = append(problems, err)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		problems = append(problems, fmt.Errorf("unknown log format '%v'", c.LogFormat))
+	}
+	if c.MOTDFile != "" {
+		if _, err := os.Stat(c.MOTDFile); err != nil {
+			problems = append(problems, fmt.Errorf("can't read MOTD file: %w", err))
+		}
+	}
+	if c.MaxConnections < 0 {
+		problems = append(problems, errors.New("max connections can't be negative"))
+	}
+	if c.MaxPerAddress < 0 {
+		problems = append(problems, errors.New("max per address can't be negative"))
+	}
+	if c.CommandRate < 0 {
+		problems = append(problems, errors.New("command rate can't be negative"))
+	}
+	if c.CommandRate > 0 && c.CommandBurst < 1 {
+		problems = append(problems, errors.New("command burst must be at least 1 when commands are rate limited"))
+	}
+	if c.IdleTimeout < 0 {
+		problems = append(problems, errors.New("idle timeout can't be negative"))
+	}
+	if c.AFKAfter < 0 {
+		problems = append(problems, errors.New("AFK after can't be negative"))
+	}
+	if c.LinkdeadTimeout < 0 {
+		problems = append(problems, errors.New("linkdead timeout can't be negative"))
+	}
+	if c.IdleTimeout > 0 && c.IdleTimeout <= idleWarning {
+		problems = append(problems, fmt.Errorf("idle timeout must be longer than the %v warning", idleWarning))
+	}
+	if c.Storage.Backend != storeFile && c.Storage.Backend != storeSQLite {
+		problems = append(problems, fmt.Errorf("unknown storage backend '%v'", c.Storage.Backend))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid configuration: %w", errors.Join(problems...))
+	}
+	return nil
+}
+
+// Sets up logging as the Config asks. The Config must already be valid.
+func (c *Config) applyLogging() {
+	level, _ := log.ParseLevel(c.LogLevel)
+	log.SetLevel(level)
+	if c.LogFormat == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+}
@@ -1,22 +1,57 @@
 package main
 
+import (
+	"strings"
+	"sync/atomic"
+)
+
 type Exit struct {
 	names       []string
 	room        *Room
 	destination *Exit
+	door        *Door // The door across this exit, shared with the other side, if any
+}
+
+// Doors sit across an exit and stop anything passing through while closed.
+type Door struct {
+	closed atomic.Bool
 }
 
-func connectRooms(start *Room, end *Room, startDir []string, endDir []string) {
+func connectRooms(start *Room, end *Room, startDir []string, endDir []string) (*Exit, *Exit) {
 	startSide := Exit{names: startDir, room: start}
 	endSide := Exit{names: endDir, room: end}
 	startSide.destination = &endSide
 	endSide.destination = &startSide
 	start.exits = append(start.exits, &startSide)
 	end.exits = append(end.exits, &endSide)
+	return &startSide, &endSide
+}
+
+func connectRoomsCardinally(start *Room, end *Room, dir Direction) (*Exit, *Exit) {
+	return connectRooms(start, end, dirToCommandStrings(dir), dirToCommandStrings(invertDir(dir)))
 }
 
-func connectRoomsCardinally(start *Room, end *Room, dir Direction) {
-	connectRooms(start, end, dirToCommandStrings(dir), dirToCommandStrings(invertDir(dir)))
+// Puts a closed door across the exit, and the exit on the other side.
+func (e *Exit) addDoor() {
+	door := &Door{}
+	door.closed.Store(true)
+	e.door = door
+	e.destination.door = door
+}
+
+// Returns true if nothing is blocking the exit.
+func (e *Exit) isOpen() bool {
+	return e.door == nil || !e.door.closed.Load()
+}
+
+// Returns true if 'name' is one of the exit's names, ignoring case.
+func (e *Exit) hasName(name string) bool {
+	for _, n := range e.names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
 }
 
 func (e *Exit) getDestination() *Room {
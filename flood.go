@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Most commands a Mob can have waiting in its queue.
+	maxQueuedCommands = 100
+	// How many commands in a row can be dropped for flooding before the
+	// connection is dropped too.
+	floodKickLimit = 50
+)
+
+// commandLimiter is a token bucket limiting how quickly a user can send
+// commands. It holds up to config.CommandBurst tokens, refilled at
+// config.CommandRate a second, and each command takes one.
+type commandLimiter struct {
+	sync.Mutex
+	tokens  float64
+	updated time.Time
+	dropped int // Commands dropped since the last one allowed
+}
+
+// Takes a token for a command, returning false if there are none left,
+// along with how many commands in a row have now been refused.
+func (cl *commandLimiter) allow(now time.Time) (allowed bool, dropped int) {
+	if config.CommandRate <= 0 {
+		return true, 0
+	}
+	cl.Lock()
+	defer cl.Unlock()
+	if cl.updated.IsZero() {
+		cl.tokens = float64(config.CommandBurst)
+	} else {
+		cl.tokens += now.Sub(cl.updated).Seconds() * config.CommandRate
+		if cl.tokens > float64(config.CommandBurst) {
+			cl.tokens = float64(config.CommandBurst)
+		}
+	}
+	cl.updated = now
+	if cl.tokens >= 1 {
+		cl.tokens--
+		cl.dropped = 0
+		return true, 0
+	}
+	cl.dropped++
+	return false, cl.dropped
+}
+
+// Checks the user isn't sending commands too quickly. Returns false if the
+// command should be ignored, warning the user the first time, and dropping
+// their connection if they carry on.
+func (u *User) allowCommand() bool {
+	allowed, dropped := u.limiter.allow(world.clock.Now())
+	switch {
+	case allowed:
+		return true
+	case dropped >= floodKickLimit:
+		// Lines already read before the connection closed still come
+		// through, so only the first of them disconnects the user.
+		if u.disconnecting.Swap(true) {
+			return false
+		}
+		log.WithFields(log.Fields{
+			"mob_name":       u.Mob.name,
+			"remote_address": u.Conn.RemoteAddr().String(),
+		}).Warn("Disconnecting player for flooding.")
+		u.write("You have been disconnected for flooding.\n")
+		if u.Mob.name != "" {
+			u.Mob.logout()
+			removeUser(u)
+		}
+		u.Conn.Close()
+	case dropped == 1:
+		u.write("You are sending commands too quickly, slow down!\n")
+	}
+	return false
+}
+
+// Counts of the connections open from each IP address.
+var (
+	connectionsByIP     = make(map[string]int)
+	connectionsByIPLock sync.Mutex
+)
+
+// Counts a connection from addr, returning false, and not counting it, if
+// there are already config.MaxPerAddress connections from there.
+func countAddress(addr net.Addr) bool {
+	ip := addressIP(addr)
+	if ip == nil {
+		return true
+	}
+	connectionsByIPLock.Lock()
+	defer connectionsByIPLock.Unlock()
+	if config.MaxPerAddress > 0 && connectionsByIP[ip.String()] >= config.MaxPerAddress {
+		return false
+	}
+	connectionsByIP[ip.String()]++
+	return true
+}
+
+func uncountAddress(addr net.Addr) {
+	ip := addressIP(addr)
+	if ip == nil {
+		return
+	}
+	connectionsByIPLock.Lock()
+	defer connectionsByIPLock.Unlock()
+	if connectionsByIP[ip.String()]--; connectionsByIP[ip.String()] <= 0 {
+		delete(connectionsByIP, ip.String())
+	}
+}
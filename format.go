@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Settings for page length that aren't a number of lines.
+const (
+	pagerAuto = 0  // Page to the height of the client's window
+	pagerOff  = -1 // Never page
+)
+
+// The prompt shown when output is paused part way through.
+const pagerPrompt = "{W}[ Press Enter to continue, or q to stop ]{x}\n"
+
+// Returns how many columns text will take up on screen, ignoring markup.
+func visibleLength(text string) int {
+	return utf8.RuneCountInString(stripMarkup(text))
+}
+
+// Word-wraps text so that no line is wider than width columns. Existing line
+// breaks are kept, and words too long to fit on a line of their own are left
+// to overflow.
+func wrapText(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if visibleLength(line) > width {
+			lines[i] = wrapLine(line, width)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Wraps a single line of text to width columns. Any indentation the line
+// starts with is repeated at the start of each line it's wrapped onto.
+func wrapLine(line string, width int) string {
+	words := strings.TrimLeft(line, " ")
+	indent := line[:len(line)-len(words)]
+	var output strings.Builder
+	output.WriteString(indent)
+	column := len(indent)
+	for _, word := range strings.Split(words, " ") {
+		length := visibleLength(word)
+		if column > len(indent) && column+1+length > width {
+			output.WriteString("\n" + indent)
+			column = len(indent)
+		} else if column > len(indent) {
+			output.WriteString(" ")
+			column++
+		}
+		output.WriteString(word)
+		column += length
+	}
+	return output.String()
+}
+
+// Returns the number of columns output to the user is wrapped to, from their
+// preferences or else their window.
+func (u *User) textWidth() int {
+	if width := u.Mob.getPreferences().Width; width > 0 {
+		return width
+	}
+	width, _ := u.windowSize()
+	return width
+}
+
+// Returns how many lines of output the user sees before it is paused, or
+// zero if it never is.
+func (u *User) pageLength() int {
+	switch length := u.Mob.getPreferences().PageLength; length {
+	case pagerOff:
+		return 0
+	case pagerAuto:
+		_, height := u.windowSize()
+		// Leave a line for the pager's prompt.
+		return height - 1
+	default:
+		return length
+	}
+}
+
+// Sends the user as much of their pending output as fits on a page. If some
+// is left over, the pager's prompt is shown and the rest waits until they
+// ask for it. The pager lock must be held.
+func (u *User) flushPage() {
+	if u.paused || len(u.pending) == 0 {
+		return
+	}
+	// A page is as many lines as fit, along with any prompt ends and GMCP
+	// messages among them.
+	length := u.pageLength()
+	count, lines := 0, 0
+	for ; count < len(u.pending); count++ {
+		if o := u.pending[count]; !o.Prompt && o.GMCP == "" {
+			if length > 0 && lines == length {
+				break
+			}
+			lines++
+		}
+	}
+	page := u.pending[:count]
+	u.pending = u.pending[count:]
+	var text strings.Builder
+	for _, o := range page {
+		switch {
+		case o.Prompt:
+			u.send(text.String())
+			text.Reset()
+			u.sendGoAhead()
+		case o.GMCP != "":
+			u.send(text.String())
+			text.Reset()
+			u.writeGMCP(o.GMCP)
+		default:
+			text.WriteString(o.Text)
+		}
+	}
+	if len(u.pending) > 0 {
+		text.WriteString(pagerPrompt)
+		u.paused = true
+	}
+	u.send(text.String())
+}
+
+// Returns true if the user's output is paused, waiting for them to ask for
+// more.
+func (u *User) paging() bool {
+	u.pagerLock.Lock()
+	defer u.pagerLock.Unlock()
+	return u.paused
+}
+
+// Handles a line of input while the user's output is paused. An empty line,
+// or 'more', shows the next page. Anything else throws the rest of the
+// output away; returns false if the input should then be run as a command.
+func (u *User) continuePaging(input string) (handled bool) {
+	u.pagerLock.Lock()
+	defer u.pagerLock.Unlock()
+	u.paused = false
+	switch strings.ToLower(strings.TrimSpace(input)) {
+	case "", "more", "c":
+		u.flushPage()
+		return true
+	case "q", "quit":
+		u.dropPending()
+		return true
+	}
+	u.dropPending()
+	return false
+}
+
+// Throws away the output waiting to be sent. GMCP messages are still sent,
+// as the client's idea of the player's state would fall behind without them.
+func (u *User) dropPending() {
+	for _, o := range u.pending {
+		if o.GMCP != "" {
+			u.writeGMCP(o.GMCP)
+		}
+	}
+	u.pending = nil
+}
+
+func widthCommand() Command {
+	return Command{
+		names: []string{"width"},
+		action: func(p *Mob, args string) ReadiedCommand {
+			return func() bool {
+				args = strings.ToLower(strings.TrimSpace(args))
+				width, err := strconv.Atoi(args)
+				switch {
+				case args == "":
+					p.tell(fmt.Sprintf("Output is wrapped to %v columns.\n", p.textWidth()))
+					return true
+				case args == "auto":
+					width = 0
+				case err != nil || width < 20 || width > 500:
+					p.tell("Use 'width auto' or a width between 20 and 500.\n")
+					return false
+				}
+				p.updatePreferences(func(prefs *Preferences) {
+					prefs.Width = width
+				})
+				p.tell(fmt.Sprintf("Output is now wrapped to %v columns.\n", p.textWidth()))
+				return true
+			}
+		},
+	}
+}
+
+func pagerCommand() Command {
+	return Command{
+		names: []string{"pager"},
+		action: func(p *Mob, args string) ReadiedCommand {
+			return func() bool {
+				args = strings.ToLower(strings.TrimSpace(args))
+				length, err := strconv.Atoi(args)
+				switch {
+				case args == "":
+					p.tell(p.describePager())
+					return true
+				case args == "auto":
+					length = pagerAuto
+				case args == "off":
+					length = pagerOff
+				case err != nil || length < 5 || length > 500:
+					p.tell("Use 'pager auto', 'pager off' or a page length between 5 and 500.\n")
+					return false
+				}
+				p.updatePreferences(func(prefs *Preferences) {
+					prefs.PageLength = length
+				})
+				p.tell(p.describePager())
+				return true
+			}
+		},
+	}
+}
+
+func (m *Mob) describePager() string {
+	switch length := m.getPreferences().PageLength; length {
+	case pagerOff:
+		return "Long output is never paused.\n"
+	case pagerAuto:
+		return "Long output is paused when it fills your window.\n"
+	default:
+		return fmt.Sprintf("Long output is paused every %v lines.\n", length)
+	}
+}
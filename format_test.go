@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestWrapText(t *testing.T) {
+	for _, test := range []struct {
+		name, text string
+		width      int
+		want       string
+	}{
+		{"fits", "a short line", 20, "a short line"},
+		{"wrapped", "one two three four", 9, "one two\nthree\nfour"},
+		{"breaks kept", "one two\nthree four", 9, "one two\nthree\nfour"},
+		{"markup ignored", "{title}one{x} two three", 9, "{title}one{x} two\nthree"},
+		{"indent kept", "  one two three four", 9, "  one two\n  three\n  four"},
+		{"long word", "one overflowing two", 5, "one\noverflowing\ntwo"},
+		{"no width", "one two three", 0, "one two three"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := wrapText(test.text, test.width); got != test.want {
+				t.Errorf("Got %q, want %q.", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRoomRulesFitTheWrappedDescription(t *testing.T) {
+	room := newUnlinkedRoom("one two three four", "Hall")
+	want := "\n|{title}Hall{x}|\n-------\none two three four\n-------\n\n"
+	if got := room.getDescription(9); got != want {
+		t.Errorf("Got %q, want %q.", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GMCP, the Generic MUD Communication Protocol, sends MUD clients
+// structured data alongside the text, over telnet option 201. Each message
+// is a package name followed by a JSON payload, e.g.
+//
+//	Char.Vitals {"hp":20,"maxhp":20}
+const telnetGMCP byte = 201
+
+// GMCPRoomInfo is the payload of Room.Info, sent when a player moves.
+type GMCPRoomInfo struct {
+	ID    string            `json:"id"`
+	Name  string            `json:"name"`
+	Area  string            `json:"area"`
+	Exits map[string]string `json:"exits"` // Directions to the IDs of the Rooms they lead to
+}
+
+// GMCPVitals is the payload of Char.Vitals.
+type GMCPVitals struct {
+	HP    int `json:"hp"`
+	MaxHP int `json:"maxhp"`
+}
+
+// GMCPStatus is the payload of Char.Status.
+type GMCPStatus struct {
+	Name    string `json:"name"`
+	Area    string `json:"area"`
+	Builder bool   `json:"builder"`
+	Admin   bool   `json:"admin"`
+}
+
+// GMCPChannelText is the payload of Comm.Channel.Text, sent for each thing
+// said on a channel the player can hear.
+type GMCPChannelText struct {
+	Channel string `json:"channel"`
+	Talker  string `json:"talker"`
+	Text    string `json:"text"`
+}
+
+// Sends the user a GMCP message, if their client has agreed to GMCP.
+// Messages for state, rather than events, are only sent when the state
+// has changed since it was last sent.
+func (u *User) sendGMCP(pkg string, data interface{}, state bool) {
+	if !u.gmcp.Load() {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.WithError(err).WithField("package", pkg).Error("Could not encode GMCP message.")
+		return
+	}
+	if state {
+		u.gmcpLock.Lock()
+		unchanged := u.gmcpSent[pkg] == string(payload)
+		u.gmcpSent[pkg] = string(payload)
+		u.gmcpLock.Unlock()
+		if unchanged {
+			return
+		}
+	}
+	// Sent along with the Mob's other output, so it arrives in order with
+	// the text it goes with.
+	u.Mob.deliver(Output{GMCP: pkg + " " + string(payload)})
+}
+
+// Sends the user a GMCP message straight away.
+func (u *User) writeGMCP(message string) {
+	u.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	u.Conn.Write(telnetSubnegotiation(telnetGMCP, []byte(message)...))
+}
+
+// Handles a GMCP message from the client. Clients announce the packages
+// they support, but every client we know of copes with being sent the
+// others, so they're only logged.
+func (u *User) receiveGMCP(message []byte) {
+	pkg, data, _ := strings.Cut(string(message), " ")
+	log.WithFields(log.Fields{
+		"remote_address": u.Conn.RemoteAddr().String(),
+		"package":        pkg,
+		"data":           data,
+	}).Debug("GMCP received.")
+}
+
+// Sends the player's client any of the Mob's state that's changed: where it
+// is, its vitals and its status.
+func (m *Mob) updateGMCP() {
+	user, err := getUserFromMob(m)
+	if err != nil || m.location == nil {
+		return
+	}
+	room := m.location
+	info := GMCPRoomInfo{ID: room.id, Name: room.name, Exits: make(map[string]string)}
+	if room.area != nil {
+		info.Area = room.area.name
+	}
+	for _, exit := range room.exits {
+		info.Exits[strings.ToLower(exit.getPrimaryName())] = exit.destination.room.id
+	}
+	user.sendGMCP("Room.Info", info, true)
+	user.sendGMCP("Char.Vitals", GMCPVitals{HP: m.hp, MaxHP: m.maxHP}, true)
+	user.sendGMCP("Char.Status", GMCPStatus{Name: m.name, Area: info.Area, Builder: m.builder, Admin: m.admin}, true)
+}
+
+// Sends Comm.Channel.Text to the players in location, for something said
+// there by talker.
+func roomChannelGMCP(channel, talker, text string, location *Room) {
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	for _, user := range users {
+		if user.Mob.location == location {
+			user.sendGMCP("Comm.Channel.Text", GMCPChannelText{Channel: channel, Talker: talker, Text: text}, false)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestGMCPIsSentInOrderWithText(t *testing.T) {
+	conn := newHarnessConn("gmcp")
+	u := &User{Conn: conn, Mob: newMob(), telnet: true, gmcpSent: make(map[string]string)}
+	u.gmcp.Store(true)
+	u.Mob.connect(u.deliver)
+	defer u.Mob.disconnect()
+	u.Mob.tell("You go east.\n")
+	u.sendGMCP("Room.Info", GMCPRoomInfo{ID: "testmap:2,0", Name: "Boardroom"}, true)
+	u.Mob.deliver(Output{Text: "> ", Prompt: true})
+	// Each message is only taken once the one before has been written.
+	u.Mob.tell("")
+	want := "You go east.\n" +
+		"\xff\xfa\xc9Room.Info {\"id\":\"testmap:2,0\",\"name\":\"Boardroom\",\"area\":\"\",\"exits\":null}\xff\xf0" +
+		"> \xff\xf9"
+	if got := conn.takeOutput(); got != want {
+		t.Errorf("Sent %q, want %q.", got, want)
+	}
+}
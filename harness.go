@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Harness runs the game with no network and no beat of its own, so play
+// sessions can be scripted: sessions connect over fake connections, the
+// world only moves on when it is stepped, and each session's output can be
+// checked after every command. It plays by the server's config, but takes
+// over the game's other globals, so only one Harness can run at a time, and
+// never alongside a real server.
+type Harness struct {
+	dir      string       // Temporary directory the Harness's store is kept in
+	clock    *manualClock // The world's clock, moved on a tick each beat
+	sessions int          // How many sessions have connected, for naming them
+	previous harnessGlobals
+}
+
+// harnessGlobals are the game's globals a Harness takes over, kept so they
+// can be put back when it's closed.
+type harnessGlobals struct {
+	config       Config
+	users        []*User
+	bans         []Ban
+	linkdeadMobs map[string]*linkdeadMob
+	world        *World
+	store        Store
+}
+
+// When the world starts, by a Harness's clock. It's the same every run so
+// that timed output, such as the prompt's clock, is too.
+var harnessEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Starts a Harness with a fresh copy of the world kept in worldDir, and an
+// empty store that is thrown away when the Harness is closed.
+func newHarness(worldDir string) (*Harness, error) {
+	area, err := loadMap(worldDir)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "sud-harness-")
+	if err != nil {
+		return nil, err
+	}
+	saves, err := openFileStore(filepath.Join(dir, "save"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	h := &Harness{dir: dir, clock: newManualClock(harnessEpoch)}
+	h.previous = harnessGlobals{config, users, bans, linkdeadMobs, world, store}
+	store = saves
+	config.WorldDir = worldDir
+	// Scripts send commands far faster than anyone can type.
+	config.CommandRate = 0
+	config.RecordDir = ""
+	usersLock.Lock()
+	users = nil
+	usersLock.Unlock()
+	bansLock.Lock()
+	bans = nil
+	bansLock.Unlock()
+	linkdeadLock.Lock()
+	linkdeadMobs = make(map[string]*linkdeadMob)
+	linkdeadLock.Unlock()
+	world = newWorld(area)
+	world.tick = config.Tick
+	world.startStepped(h.clock)
+	watchIdle()
+	return h, nil
+}
+
+// Stops the world, throws away everything the Harness saved and puts back
+// the globals it took over.
+func (h *Harness) close() error {
+	linkdeadLock.Lock()
+	for _, entry := range linkdeadMobs {
+		entry.timer.Stop()
+	}
+	linkdeadMobs = h.previous.linkdeadMobs
+	linkdeadLock.Unlock()
+	world.stopWorld()
+	store.Close()
+	usersLock.Lock()
+	users = h.previous.users
+	usersLock.Unlock()
+	bansLock.Lock()
+	bans = h.previous.bans
+	bansLock.Unlock()
+	config, world, store = h.previous.config, h.previous.world, h.previous.store
+	return os.RemoveAll(h.dir)
+}
+
+// Runs the world for the given number of beats, calling any timers that
+// come due along the way.
+func (h *Harness) step(beats int) {
+	for i := 0; i < beats; i++ {
+		h.clock.advance(world.tick)
+		world.step()
+	}
+}
+
+// Runs the world until it has been running for the given number of beats.
+func (h *Harness) stepTo(beat int) {
+	for world.beats() < beat {
+		h.step(1)
+	}
+}
+
+// Opens a new session, as though a player had connected, and returns it
+// once the greeting has been sent.
+func (h *Harness) connect() *Session {
+	return h.connectAs("")
+}
+
+// Opens a new session already logged in to account, as though the player
+// had connected over SSH.
+func (h *Harness) connectAs(account string) *Session {
+	h.sessions++
+	s := &Session{
+		harness: h,
+		conn:    newHarnessConn(fmt.Sprintf("session-%v", h.sessions)),
+		done:    make(chan bool),
+	}
+	go func() {
+		handleConnection(s.conn, false, account)
+		close(s.done)
+	}()
+	s.conn.waitForRead()
+	return s
+}
+
+// Session is a player connected to a Harness.
+type Session struct {
+	harness *Harness
+	conn    *harnessConn
+	done    chan bool // Closed once the game has finished with the session
+}
+
+// Most beats a Session waits for its queued commands to run.
+const maxSessionBeats = maxQueuedCommands + 1
+
+// Types line into the session and waits for the game to read it. Commands
+// that are queued rather than run straight away need the world stepping.
+func (s *Session) send(line string) error {
+	if !s.conn.writeInput(line + "\r\n") {
+		return fmt.Errorf("Session %v has been disconnected.", s.conn.name)
+	}
+	s.conn.waitForRead()
+	return nil
+}
+
+// Types line into the session and steps the world until everything the
+// player has queued has run, then returns the output it produced.
+func (s *Session) do(line string) (string, error) {
+	if err := s.send(line); err != nil {
+		return s.output(), err
+	}
+	for beats := 0; s.queued() > 0; beats++ {
+		if beats == maxSessionBeats {
+			return s.output(), fmt.Errorf("Session %v still had commands queued after %v beats.", s.conn.name, beats)
+		}
+		s.harness.step(1)
+	}
+	return s.output(), nil
+}
+
+// Types line into the session, as with do, and returns an error if the
+// output doesn't contain want.
+func (s *Session) expect(line, want string) error {
+	output, err := s.do(line)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(output, want) {
+		return fmt.Errorf("Output of %q didn't contain %q, got:\n%v", line, want, output)
+	}
+	return nil
+}
+
+// Returns the User playing the session, or nil if it isn't logged in.
+func (s *Session) user() *User {
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	for _, user := range users {
+		if user.Conn == net.Conn(s.conn) {
+			return user
+		}
+	}
+	return nil
+}
+
+// Returns how many commands the session's Mob has waiting.
+func (s *Session) queued() int {
+	user := s.user()
+	if user == nil {
+		return 0
+	}
+	user.Mob.queueLock.Lock()
+	defer user.Mob.queueLock.Unlock()
+	return len(user.Mob.cmdQueue)
+}
+
+// Matches the ANSI escape codes colour is rendered as.
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Returns everything sent to the session since the last call, without
+// colour.
+func (s *Session) output() string {
+	// The Mob's output is passed along a channel to be written, so once an
+	// empty message has been taken from it, everything before it has been
+	// written.
+	if user := s.user(); user != nil {
+		user.Mob.tell("")
+	}
+	return ansiEscape.ReplaceAllString(s.conn.takeOutput(), "")
+}
+
+// Changes the size of the session's window.
+func (s *Session) resize(width, height int) {
+	s.conn.width.Store(int32(width))
+	s.conn.height.Store(int32(height))
+}
+
+// Drops the session's connection, as though the player had lost it, and
+// waits for the game to notice.
+func (s *Session) close() {
+	s.conn.Close()
+	<-s.done
+}
+
+// harnessConn is the fake connection a Session is played over. Lines are
+// handed to the game one at a time, and each time the game comes back for
+// more, the Session knows the last line has been dealt with.
+type harnessConn struct {
+	name      string
+	input     chan string // Lines typed into the session
+	reading   chan bool   // Sent on each time the game waits for input
+	pending   []byte      // Input taken from a line but not yet read
+	closed    chan bool
+	closeOnce sync.Once
+	output    bytes.Buffer
+	lock      sync.Mutex // Guards output
+	width     atomic.Int32
+	height    atomic.Int32
+}
+
+func newHarnessConn(name string) *harnessConn {
+	return &harnessConn{
+		name:    name,
+		input:   make(chan string),
+		reading: make(chan bool),
+		closed:  make(chan bool),
+	}
+}
+
+// Waits until the game asks for more input, or the connection is closed.
+func (hc *harnessConn) waitForRead() {
+	select {
+	case <-hc.reading:
+	case <-hc.closed:
+	}
+}
+
+// Hands line to the game, returning false if the connection is closed.
+func (hc *harnessConn) writeInput(line string) bool {
+	select {
+	case hc.input <- line:
+		return true
+	case <-hc.closed:
+		return false
+	}
+}
+
+func (hc *harnessConn) takeOutput() string {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	output := hc.output.String()
+	hc.output.Reset()
+	return output
+}
+
+func (hc *harnessConn) Read(p []byte) (int, error) {
+	if len(hc.pending) == 0 {
+		select {
+		case hc.reading <- true:
+		case <-hc.closed:
+			return 0, io.EOF
+		}
+		select {
+		case line := <-hc.input:
+			hc.pending = []byte(line)
+		case <-hc.closed:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, hc.pending)
+	hc.pending = hc.pending[n:]
+	return n, nil
+}
+
+func (hc *harnessConn) Write(p []byte) (int, error) {
+	select {
+	case <-hc.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	return hc.output.Write(p)
+}
+
+func (hc *harnessConn) Close() error {
+	err := errors.New("Connection already closed.")
+	hc.closeOnce.Do(func() {
+		close(hc.closed)
+		err = nil
+	})
+	return err
+}
+
+// Unless they're resized, sessions have a window tall enough that their
+// output is never paged.
+func (hc *harnessConn) windowSize() (width, height int) {
+	width, height = int(hc.width.Load()), int(hc.height.Load())
+	if height <= 0 {
+		height = 1000
+	}
+	return
+}
+
+func (hc *harnessConn) LocalAddr() net.Addr {
+	return harnessAddr("harness")
+}
+
+func (hc *harnessConn) RemoteAddr() net.Addr {
+	return harnessAddr(hc.name)
+}
+
+func (hc *harnessConn) SetDeadline(t time.Time) error      { return nil }
+func (hc *harnessConn) SetReadDeadline(t time.Time) error  { return nil }
+func (hc *harnessConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// harnessAddr is the address of one end of a harnessConn.
+type harnessAddr string
+
+func (ha harnessAddr) Network() string {
+	return "harness"
+}
+
+func (ha harnessAddr) String() string {
+	return string(ha)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHarnessQuitEndsTheSession(t *testing.T) {
+	h, err := newHarness("testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	s := h.connect()
+	if err := s.expect("alice", "You shall be known as 'alice'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.do("quit"); err != nil {
+		t.Fatal(err)
+	}
+	<-s.done
+	if s.user() != nil {
+		t.Error("alice is still logged in after quitting.")
+	}
+	if err := s.send("look"); err == nil {
+		t.Error("Could still type into the session after quitting.")
+	}
+}
+
+func TestHarnessPaging(t *testing.T) {
+	h, err := newHarness("testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	s := h.connect()
+	s.resize(80, 5)
+	if err := s.expect("alice", "You shall be known as 'alice'"); err != nil {
+		t.Fatal(err)
+	}
+	output, err := s.do("look")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(output, "Visible Exits") {
+		t.Errorf("A five line window wasn't paged, got:\n%v", output)
+	}
+}
+
+func TestHarnessPutsBackTheGlobals(t *testing.T) {
+	before, beforeWorld, beforeStore := config, world, store
+	h, err := newHarness("testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.connect().expect("alice", "You shall be known as 'alice'"); err != nil {
+		t.Fatal(err)
+	}
+	h.close()
+	if config.WorldDir != before.WorldDir || config.CommandRate != before.CommandRate {
+		t.Errorf("Config was left as %+v.", config)
+	}
+	if world != beforeWorld || store != beforeStore {
+		t.Error("The world or store was left as the Harness's.")
+	}
+	if len(users) != 0 {
+		t.Errorf("Left %v users connected.", len(users))
+	}
+}
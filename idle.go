@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// How long before being disconnected for idling a player is warned.
+	idleWarning = time.Minute
+	// How often connected players are checked for idling.
+	idleCheckInterval = time.Second
+	// How much longer than the idle timeout a connection's reads can block
+	// for, so that dead connections are dropped even if the player can't
+	// be told.
+	idleReapMargin = time.Minute
+	// How long a write to a connection can take before it's given up on.
+	writeTimeout = 30 * time.Second
+)
+
+// Records that the user has just sent something, bringing them back from
+// being AFK.
+func (u *User) touch() {
+	u.lastActive.Store(world.clock.Now().UnixNano())
+	u.idleWarned.Store(false)
+	if u.Mob.afk.Swap(false) {
+		u.Mob.tell("You are no longer AFK.\n")
+	}
+}
+
+// Returns how long it is since the user last sent anything.
+func (u *User) idleFor() time.Duration {
+	return world.clock.Now().Sub(time.Unix(0, u.lastActive.Load()))
+}
+
+// Checks the connected players for idling every idleCheckInterval, by the
+// world's clock, marking them AFK and eventually disconnecting them.
+func watchIdle() {
+	usersLock.Lock()
+	connected := append([]*User{}, users...)
+	usersLock.Unlock()
+	for _, user := range connected {
+		user.checkIdle(user.idleFor())
+	}
+	world.clock.AfterFunc(idleCheckInterval, watchIdle)
+}
+
+// Acts on the user having been idle for idle: marking them AFK after
+// config.AFKAfter, then warning and disconnecting them as they reach
+// config.IdleTimeout.
+func (u *User) checkIdle(idle time.Duration) {
+	m := u.Mob
+	if config.AFKAfter > 0 && idle >= config.AFKAfter && !m.afk.Swap(true) {
+		m.tell("You are now AFK.\n")
+	}
+	if config.IdleTimeout <= 0 {
+		return
+	}
+	switch {
+	case idle >= config.IdleTimeout:
+		if u.disconnecting.Load() {
+			return
+		}
+		// If the Mob's queue is full, it's tried again on the next check.
+		if !m.enqueue(func() bool {
+			u.write("You have been idle too long. Goodbye!\n")
+			m.logout()
+			disconnectUserFromMob(m)
+			return true
+		}) {
+			return
+		}
+		u.disconnecting.Store(true)
+		log.WithFields(log.Fields{
+			"mob_name": m.name,
+			"idle":     idle.Round(time.Second).String(),
+		}).Info("Disconnecting idle player.")
+	case idle >= config.IdleTimeout-idleWarning && !u.idleWarned.Swap(true):
+		m.tell(fmt.Sprintf("You will be disconnected in %v if you stay idle.\n", (config.IdleTimeout - idle).Round(time.Second)))
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIdleDisconnectWaitsForRoomInTheQueue(t *testing.T) {
+	h, err := newHarness("testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	s := h.connect()
+	if err := s.expect("alice", "You shall be known as 'alice'"); err != nil {
+		t.Fatal(err)
+	}
+	user := s.user()
+	for user.Mob.enqueue(func() bool { return true }) {
+	}
+
+	user.checkIdle(config.IdleTimeout)
+	if user.disconnecting.Load() {
+		t.Fatal("Marked as disconnecting though the disconnect couldn't be queued.")
+	}
+
+	user.Mob.clearQueue()
+	user.checkIdle(config.IdleTimeout)
+	if !user.disconnecting.Load() {
+		t.Fatal("Not marked as disconnecting once the disconnect could be queued.")
+	}
+	h.step(1)
+	<-s.done
+	if output := s.conn.takeOutput(); !strings.Contains(output, "You have been idle too long.") {
+		t.Errorf("Wasn't told why they were disconnected, got:\n%v", output)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// linkdeadMob is a Mob whose connection dropped without its player quitting.
+// It stays in the world until its player comes back or its timer runs out.
+type linkdeadMob struct {
+	mob   *Mob
+	timer Timer
+}
+
+// Linkdead Mobs by name.
+var (
+	linkdeadMobs = make(map[string]*linkdeadMob)
+	linkdeadLock sync.Mutex
+)
+
+// Leaves the Mob in the world, marked linkdead, after its connection drops.
+// If its player doesn't log back in within config.LinkdeadTimeout, the Mob
+// is saved and despawned.
+func (m *Mob) goLinkdead() {
+	m.clearQueue()
+	m.disconnect()
+	m.linkdead.Store(true)
+	world.roomEmit(m.name+" has lost their link.\n", m.location)
+	log.WithField("mob_name", m.name).Info("Mob is linkdead.")
+	audit(streamLogins, m.name, "Lost their connection.")
+
+	entry := &linkdeadMob{mob: m}
+	linkdeadLock.Lock()
+	linkdeadMobs[m.name] = entry
+	entry.timer = world.clock.AfterFunc(config.LinkdeadTimeout, func() {
+		linkdeadLock.Lock()
+		if linkdeadMobs[m.name] != entry {
+			// Its player came back, or it has gone linkdead again since.
+			linkdeadLock.Unlock()
+			return
+		}
+		delete(linkdeadMobs, m.name)
+		linkdeadLock.Unlock()
+		m.logout()
+		log.WithField("mob_name", m.name).Info("Linkdead mob timed out.")
+	})
+	linkdeadLock.Unlock()
+}
+
+// Takes the linkdead Mob called name out of the linkdead list so a new
+// connection can control it. Returns nil if there's no such Mob.
+func reclaimLinkdead(name string) *Mob {
+	linkdeadLock.Lock()
+	defer linkdeadLock.Unlock()
+	entry, found := linkdeadMobs[name]
+	if !found {
+		return nil
+	}
+	entry.timer.Stop()
+	delete(linkdeadMobs, name)
+	entry.mob.linkdead.Store(false)
+	entry.mob.afk.Store(false)
+	return entry.mob
+}
+
+// Returns the linkdead Mob called name, leaving it linkdead, or nil if
+// there's no such Mob.
+func findLinkdead(name string) *Mob {
+	linkdeadLock.Lock()
+	defer linkdeadLock.Unlock()
+	if entry, found := linkdeadMobs[name]; found {
+		return entry.mob
+	}
+	return nil
+}
+
+// Returns the Mobs that are currently linkdead.
+func linkdeadList() (mobs []*Mob) {
+	linkdeadLock.Lock()
+	defer linkdeadLock.Unlock()
+	for _, entry := range linkdeadMobs {
+		mobs = append(mobs, entry.mob)
+	}
+	return
+}
+
+// Returns the tags shown after the Mob's name in room listings and who,
+// e.g. " (linkdead)".
+func (m *Mob) statusTags() (tags string) {
+	if m.afk.Load() {
+		tags += " (AFK)"
+	}
+	if m.linkdead.Load() {
+		tags += " (linkdead)"
+	}
+	return
+}
+
+// Saves the Mob and takes it out of the world for good.
+func (m *Mob) logout() {
+	audit(streamLogins, m.name, "Logged out.")
+	if err := m.save(); err != nil {
+		log.WithError(err).Errorf("Could not save account '%v'.", m.name)
+	}
+	m.despawn()
+	m.disconnect()
+}
+
+// Gives the Mob called name to the user, taking it from a linkdead player or
+// another connection logged in as the same account. Returns false if no Mob
+// of that name is in the world.
+func (u *User) reattach(name string) bool {
+	m := reclaimLinkdead(name)
+	if m == nil {
+		previous := takeUser(name)
+		if previous == nil {
+			return false
+		}
+		previous.write("Someone has logged in as you from elsewhere.\n")
+		previous.Conn.Close()
+		m = previous.Mob
+	}
+	u.Mob = m
+	if u.authenticated {
+		// Whoever was playing the Mob may not have proved who they were.
+		if account, err := store.LoadAccount(name); err == nil {
+			m.admin = account.Admin
+		}
+	}
+	m.connect(u.deliver)
+	u.write("You take back control of " + name + ".\n")
+	world.roomEmit(name+" has reconnected.\n", m.location)
+	addUser(u)
+	m.tell(m.location.displayRoom(m.textWidth()))
+	m.showPrompt()
+	log.WithField("mob_name", name).Info("Mob reattached.")
+	return true
+}
@@ -1,10 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -13,60 +22,213 @@ import (
 type User struct {
 	Conn net.Conn
 	// Add any additional user-related data you need to track here
-	Mob *Mob
+	Mob           *Mob
+	telnet        bool              // Whether the client speaks telnet, rather than plain text
+	width         atomic.Int32      // Client window width, reported over NAWS
+	height        atomic.Int32      // Client window height, reported over NAWS
+	clientANSI    atomic.Bool       // Whether the client has said it can show colour, over TTYPE
+	useEOR        atomic.Bool       // Whether the client wants prompts marked with EOR rather than GA
+	gmcp          atomic.Bool       // Whether the client has agreed to GMCP
+	gmcpSent      map[string]string // GMCP packages to the payloads last sent for them
+	gmcpLock      sync.Mutex
+	lastActive    atomic.Int64 // When the user last sent anything, in Unix nanoseconds
+	idleWarned    atomic.Bool  // Whether the user has been warned they'll be disconnected for idling
+	disconnecting atomic.Bool  // Whether the user is already being disconnected for idling or flooding
+	limiter       commandLimiter
+	pending       []Output // Lines of output waiting to be sent, with the prompt ends and GMCP messages among them
+	paused        bool     // Whether output is paused, waiting for the user to ask for more
+	pagerLock     sync.Mutex
+	recorder      *sessionRecorder // Nil unless the session is being recorded
+	authenticated bool             // Whether the player proved who they are, by logging in with an SSH key
+}
+
+// Queues msg to be sent to the user, wrapped to their width. Output longer
+// than a page is paused after each page.
+func (u *User) write(msg string) {
+	u.deliver(Output{Text: msg})
+}
+
+// Queues o to be sent to the user, as with write. The end of a prompt is
+// queued after its last line, so it isn't marked until it's been shown, and
+// GMCP messages wait behind the text before them.
+func (u *User) deliver(o Output) {
+	u.pagerLock.Lock()
+	defer u.pagerLock.Unlock()
+	if o.GMCP != "" {
+		u.pending = append(u.pending, o)
+		u.flushPage()
+		return
+	}
+	for _, line := range strings.SplitAfter(wrapText(o.Text, u.textWidth()), "\n") {
+		u.pending = append(u.pending, Output{Text: line})
+	}
+	if o.Prompt {
+		u.pending = append(u.pending, Output{Prompt: true})
+	}
+	u.flushPage()
+}
+
+// Sends msg to the user straight away, with its colour markup rendered as
+// they've asked. Telnet clients have any IAC bytes in it doubled, so they
+// aren't taken as commands.
+func (u *User) send(msg string) {
+	if msg == "" {
+		return
+	}
+	prefs := u.Mob.getPreferences()
+	u.recorder.record(SessionEvent{Kind: eventOutput, Text: stripMarkup(msg)})
+	msg = renderMarkup(msg, wantsColour(prefs.Colour, u.clientANSI.Load()), prefs.Theme)
+	if u.telnet {
+		msg = strings.ReplaceAll(msg, string([]byte{telnetIAC}), string([]byte{telnetIAC, telnetIAC}))
+	}
+	u.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	u.Conn.Write([]byte(msg))
+}
+
+// Tells a telnet client that the prompt it's just been sent is complete,
+// with EOR if it has agreed to that or else GA. Other clients don't need
+// telling.
+func (u *User) sendGoAhead() {
+	if !u.telnet {
+		return
+	}
+	command := telnetGA
+	if u.useEOR.Load() {
+		command = telnetEOR
+	}
+	u.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	u.Conn.Write([]byte{telnetIAC, command})
+}
+
+// Default window size for clients that don't report one.
+const (
+	defaultWindowWidth  = 80
+	defaultWindowHeight = 24
+)
+
+func (u *User) setWindowSize(width, height int) {
+	u.width.Store(int32(width))
+	u.height.Store(int32(height))
+}
+
+// windowSizer is a connection that knows the size of the client's window
+// itself, rather than being told it over telnet.
+type windowSizer interface {
+	windowSize() (width, height int)
+}
+
+// Returns the size of the user's window, falling back to the defaults for
+// any dimension the client hasn't reported.
+func (u *User) windowSize() (width, height int) {
+	if sizer, ok := u.Conn.(windowSizer); ok {
+		width, height = sizer.windowSize()
+	} else {
+		width, height = int(u.width.Load()), int(u.height.Load())
+	}
+	if width <= 0 {
+		width = defaultWindowWidth
+	}
+	if height <= 0 {
+		height = defaultWindowHeight
+	}
+	return
 }
 
 var (
 	users     []*User
 	usersLock sync.Mutex
 	world     *World
+	store     Store
+	config    = defaultConfig()
 )
 
-func handleConnection(conn net.Conn) {
+// idleReader sets a deadline before each read from a connection, so a
+// connection that sends nothing for too long is dropped.
+type idleReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (ir idleReader) Read(p []byte) (int, error) {
+	if ir.timeout > 0 {
+		ir.conn.SetReadDeadline(time.Now().Add(ir.timeout))
+	}
+	return ir.conn.Read(p)
+}
+
+// Runs a user's session over conn. Telnet clients are sent, and can send,
+// telnet negotiation; other clients just exchange text. Clients that have
+// already proven which account they own, over SSH, give its name as account
+// and skip choosing a name.
+func handleConnection(conn net.Conn, telnet bool, account string) {
+	if telnet {
+		// Output is compressed once the client asks for it.
+		conn = newMCCPConn(conn)
+	}
 	defer conn.Close()
 	log.Info("New connection established from ", conn.RemoteAddr())
 
 	// Create a new user and add it to the list
-	user := &User{Conn: conn, Mob: newMob()}
-	fmt.Println(user.Mob.name)
+	user := &User{Conn: conn, Mob: newMob(), telnet: telnet, gmcpSent: make(map[string]string), authenticated: account != ""}
+	user.touch()
+	user.recorder = startRecording(conn, account)
+	defer user.recorder.close()
+	var input io.Reader = idleReader{conn, 0}
+	if config.IdleTimeout > 0 {
+		input = idleReader{conn, config.IdleTimeout + idleReapMargin}
+	}
+	if telnet {
+		// Ask the client to report its window size and terminal type.
+		conn.Write(telnetCommand(telnetDO, telnetNAWS))
+		conn.Write(telnetCommand(telnetDO, telnetTTYPE))
+		conn.Write(telnetCommand(telnetWILL, telnetEOROption))
+		conn.Write(telnetCommand(telnetWILL, telnetGMCP))
+		conn.Write(telnetCommand(telnetWILL, telnetCOMPRESS2))
+		input = newTelnetReader(input, user)
+	} else {
+		// The other clients, the browser client and SSH terminals, all
+		// show colour.
+		user.clientANSI.Store(true)
+	}
 	// Send a welcome message to the user
-	welcomeMessage := "Welcome to the Telnet Game!\nPlease select a name: \n"
-	conn.Write([]byte(welcomeMessage))
-
-	// Receive and process commands from the user
-	for {
-		// Create a buffer to hold the incoming data
-
-		buffer := make([]byte, 1024)
-
-		// Read data from the connection into the buffer
-		bytesRead, err := conn.Read(buffer)
-		if err != nil {
-			fmt.Println("Error reading from connection:", err)
-			log.WithError(err).Warn("Error reading from connection.")
-			// Remove the user from the list if an error occurs
-			removeUser(user)
+	if account != "" {
+		user.write(greetingScreen.render(""))
+		if !user.login(account) {
 			return
 		}
+	} else {
+		user.write(greetingScreen.render("") + "Please select a name: \n")
+	}
 
-		// Convert the received data to a string
-		command := string(buffer[:bytesRead])
-		command = strings.TrimRight(command, " \n\r")
+	// Receive and process commands from the user, one line at a time.
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		command := strings.TrimRight(scanner.Text(), " \n\r")
+		width, height := user.windowSize()
+		user.recorder.record(SessionEvent{Kind: eventInput, Text: command, Width: width, Height: height})
+		user.touch()
+		if !user.allowCommand() {
+			continue
+		}
 		if user.Mob.name == "" {
-			conn.Write([]byte(fmt.Sprintf("You shall be known as '%v'.\n", command)))
-			output := make(chan string)
-			user.Mob.connect(output)
-			go func() {
-
-				for {
-					select {
-					case msg := <-output:
-						conn.Write([]byte(msg))
-					}
-				}
-			}()
-			user.Mob.spawn(command, world)
-			addUser(user)
+			if command == "" {
+				continue
+			}
+			if !validName(command) {
+				user.write("Names must be 2 to 20 letters or digits.\nPlease select a name: \n")
+				continue
+			}
+			if refusal := user.loginRefusal(command); refusal != "" {
+				user.write(refusal + "Please select a name: \n")
+				continue
+			}
+			if !user.login(command) {
+				return
+			}
+			continue
+		}
+
+		if user.paging() && user.continuePaging(command) {
 			continue
 		}
 
@@ -74,6 +236,60 @@ func handleConnection(conn net.Conn) {
 		processCommand(user, command)
 
 	}
+	if err := scanner.Err(); err != nil {
+		log.WithError(err).Warn("Error reading from connection.")
+	}
+	// Remove the user from the list once the connection ends. If they
+	// didn't quit, their Mob waits in the world for them to come back.
+	if removeUser(user) && user.Mob.name != "" {
+		user.Mob.goLinkdead()
+	}
+}
+
+// Loads the character called name and puts it into the world for the user,
+// or gives them back control of it if it's already in the world. Returns
+// false, having told the user, if the character can't be loaded.
+func (u *User) login(name string) bool {
+	if !u.reattach(name) {
+		if err := u.Mob.load(name); err != nil {
+			log.WithError(err).Errorf("Could not load account '%v'.", name)
+			u.write("Your character could not be loaded, please try again later.\n")
+			return false
+		}
+		// Anyone can type an admin's name, so only those who have proved
+		// who they are get an admin's powers.
+		u.Mob.admin = u.Mob.admin && u.authenticated
+		u.write(fmt.Sprintf("You shall be known as '%v'.\n", name))
+		u.Mob.connect(u.deliver)
+		u.Mob.showLoginScreens(name)
+		u.Mob.spawn(name, world, u.textWidth())
+		addUser(u)
+		u.Mob.showPrompt()
+	}
+	u.recordLogin()
+	audit(streamLogins, name, "Logged in from %v.", u.Conn.RemoteAddr())
+	return true
+}
+
+// Returns why the user can't log in as name, or "" if they can. A player
+// who hasn't proved who they are can't play an account that has SSH keys,
+// or take over a character someone else is playing.
+func (u *User) loginRefusal(name string) string {
+	if u.authenticated {
+		return ""
+	}
+	account, err := store.LoadAccount(name)
+	if err == nil && len(account.SSHKeys) > 0 {
+		return fmt.Sprintf("'%v' can only be played by logging in with an SSH key.\n", name)
+	}
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	for _, user := range users {
+		if user.Mob.name == name {
+			return fmt.Sprintf("'%v' is already being played.\n", name)
+		}
+	}
+	return ""
 }
 
 func addUser(user *User) {
@@ -83,12 +299,14 @@ func addUser(user *User) {
 }
 
 func getUserFromMob(m *Mob) (*User, error) {
+	usersLock.Lock()
+	defer usersLock.Unlock()
 	for _, u := range users {
 		if u.Mob == m {
 			return u, nil
 		}
 	}
-	return nil, fmt.Errorf("Could not find user with mob '%v' in connection pool.", m)
+	return nil, fmt.Errorf("Could not find user with mob '%v' in connection pool.", m.name)
 }
 
 func disconnectUserFromMob(m *Mob) {
@@ -100,7 +318,8 @@ func disconnectUserFromMob(m *Mob) {
 	}
 }
 
-func removeUser(user *User) {
+// Removes the user from the list, returning false if they weren't in it.
+func removeUser(user *User) bool {
 	usersLock.Lock()
 	defer usersLock.Unlock()
 	for i, u := range users {
@@ -108,9 +327,25 @@ func removeUser(user *User) {
 			// Remove the user from the list by swapping it with the last element and truncating the slice
 			users[i] = users[len(users)-1]
 			users = users[:len(users)-1]
-			break
+			return true
+		}
+	}
+	return false
+}
+
+// Removes the user controlling the Mob called name from the list and
+// returns them, or nil if no one is.
+func takeUser(name string) *User {
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	for i, u := range users {
+		if u.Mob.name == name {
+			users[i] = users[len(users)-1]
+			users = users[:len(users)-1]
+			return u
 		}
 	}
+	return nil
 }
 
 func processCommand(user *User, command string) {
@@ -122,35 +357,188 @@ func processCommand(user *User, command string) {
 		"command":        command,
 		"remote_address": user.Conn.RemoteAddr(),
 	}).Info("Command received")
+	audit(streamCommands, user.Mob.name, "%v", command)
 
+	queued := true
 	firstPart, otherParts, _ := strings.Cut(command, " ")
 	availableActions := append(user.Mob.commands, user.Mob.location.getExitCommands()...)
-	action := readyCommand(firstPart, availableActions)
-	user.Mob.cmdQueue = append(user.Mob.cmdQueue, action(user.Mob, otherParts))
+	cmd, found := findCommand(firstPart, availableActions)
+	// A whole line of steps is a speedwalk, even if its first step is also
+	// the name of an exit, as in "n 2e".
+	directions, speedwalk := parseSpeedwalk(command)
+	switch {
+	case command == "":
+		// An empty line does nothing but bring back the prompt.
+		queued = user.Mob.enqueue(func() bool { return true })
+	case speedwalk:
+		metrics.countCommand("speedwalk")
+		queued = user.Mob.queueMoves(directions)
+	case !found:
+		metrics.countCommand("unknown")
+		queued = user.Mob.enqueue(noCommandAction(user.Mob, otherParts))
+	case cmd.immediate:
+		metrics.countCommand(cmd.names[0])
+		cmd.action(user.Mob, otherParts)()
+		user.Mob.showPrompt()
+	default:
+		metrics.countCommand(cmd.names[0])
+		queued = user.Mob.enqueue(cmd.action(user.Mob, otherParts))
+	}
+	if !queued {
+		user.write("You have too many commands waiting. Type 'stop' to clear them.\n")
+	}
+}
+
+// Saves the world when the server is asked to stop, then exits.
+func saveOnShutdown() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	log.WithField("signal", sig).Info("Shutting down.")
+	world.save()
+	store.Close()
+	os.Exit(0)
 }
 
 func main() {
-	port := "0.0.0.0:8080" // Telnet default port
+	var err error
+	if config, err = loadConfig(os.Args[1:]); errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		log.WithError(err).Fatal("Could not load configuration.")
+	}
+	config.applyLogging()
+	if config.Scrape != "" {
+		if err := printScrape(config.Scrape, os.Stdout); err != nil {
+			log.WithError(err).Fatal("Could not scrape metrics.")
+		}
+		return
+	}
+	if config.Replay != "" {
+		differences, err := replaySession(config.Replay, config.WorldDir)
+		if err != nil {
+			log.WithError(err).Fatal("Could not replay session.")
+		}
+		if len(differences) > 0 {
+			fmt.Println(strings.Join(differences, "\n"))
+			os.Exit(1)
+		}
+		fmt.Println("The replay's output matched the recording.")
+		return
+	}
 
-	rooms := CreateMap("testmap")
-	world = newWorld(rooms)
+	if store, err = openStore(config.Storage.Backend, config.Storage.Path); err != nil {
+		log.WithError(err).Fatal("Could not open storage.")
+	}
+	defer store.Close()
+	if config.MigrateFrom != "" {
+		from, err := openStoreSpec(config.MigrateFrom)
+		if err != nil {
+			log.WithError(err).Fatal("Could not open storage to migrate from.")
+		}
+		defer from.Close()
+		if err := migrateStore(from, store); err != nil {
+			log.WithError(err).Fatal("Could not migrate storage.")
+		}
+		return
+	}
+
+	area := CreateMap(config.WorldDir)
+	world = newWorld(area)
+	world.tick = config.Tick
+	world.autosave = config.Autosave
+	world.store = store
 	world.startWorld()
 	defer world.stopWorld()
+	if err := world.restoreSnapshot(store); err != nil {
+		log.WithError(err).Fatal("Could not restore the world.")
+	}
+	if err := loadBans(); err != nil {
+		log.WithError(err).Fatal("Could not load bans.")
+	}
+	go saveOnShutdown()
+	world.clock.AfterFunc(idleCheckInterval, watchIdle)
 
-	listener, err := net.Listen("tcp", port)
-	if err != nil {
-		log.WithError(err).Fatal("Error listening on port", port)
-		return
+	// Open every listener before accepting anything, so a bad address stops
+	// the server straight away.
+	listeners := []net.Listener{}
+	for _, addr := range config.Listen {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.WithError(err).Fatal("Error listening on port ", addr)
+		}
+		defer listener.Close()
+		log.Infof("Server is listening on port %v", addr)
+		listeners = append(listeners, listener)
+	}
+	for _, listener := range listeners {
+		go acceptConnections(listener)
+	}
+	if config.SSHListen != "" {
+		if err := serveSSH(config.SSHListen); err != nil {
+			log.WithError(err).Fatal("Error listening on port ", config.SSHListen)
+		}
 	}
-	defer listener.Close()
-	log.Infof("Server is listening on port %v", port)
+	if config.AdminListen != "" {
+		if err := serveAdmin(config.AdminListen); err != nil {
+			log.WithError(err).Fatal("Error listening on port ", config.AdminListen)
+		}
+	}
+	if config.WebListen != "" {
+		if err := serveWebClient(config.WebListen); err != nil {
+			log.WithError(err).Fatal("Error listening on port ", config.WebListen)
+		}
+	}
+	select {}
+}
+
+// Number of connections currently open.
+var connectionCount atomic.Int32
 
+// Counts a new connection towards the server's limits. Returns false, having
+// told the client why, if its address is banned, or there are already too
+// many connections from it or in total. Connections that are admitted must
+// be released when they close.
+func admitConnection(conn net.Conn) bool {
+	logger := log.WithField("remote_address", conn.RemoteAddr().String())
+	if ban, banned := findBan(conn.RemoteAddr()); banned {
+		logger.WithField("ban", ban.Address).Warn("Connection refused, address is banned.")
+		conn.Write([]byte("You are banned from this server.\n"))
+		return false
+	}
+	if !countAddress(conn.RemoteAddr()) {
+		logger.Warn("Connection refused, too many connections from the address.")
+		conn.Write([]byte("Sorry, there are too many connections from your address.\n"))
+		return false
+	}
+	if count := connectionCount.Add(1); config.MaxConnections > 0 && int(count) > config.MaxConnections {
+		logger.Warn("Connection refused, server is full.")
+		conn.Write([]byte("Sorry, the server is full. Please try again later.\n"))
+		releaseConnection(conn)
+		return false
+	}
+	return true
+}
+
+func releaseConnection(conn net.Conn) {
+	connectionCount.Add(-1)
+	uncountAddress(conn.RemoteAddr())
+}
+
+func acceptConnections(listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			log.WithError(err).Fatal("Error accepting connection.")
 			continue
 		}
-		go handleConnection(conn)
+		if !admitConnection(conn) {
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer releaseConnection(conn)
+			handleConnection(conn, true, "")
+		}()
 	}
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoginNeedsProofForAdminsAndKeyedAccounts(t *testing.T) {
+	h, err := newHarness("testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	if err := store.SaveAccount(Account{Name: "root", Admin: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveAccount(Account{Name: "keyed", SSHKeys: []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	typed := h.connect()
+	other := h.connect()
+	for _, step := range []struct {
+		session *Session
+		line    string
+		want    string
+	}{
+		{typed, "root", "You shall be known as 'root'"},
+		{typed, "ban 10.0.0.1 Testing.", "Only admins can ban players."},
+		{other, "root", "'root' is already being played."},
+		{other, "keyed", "'keyed' can only be played by logging in with an SSH key."},
+		{other, "bob", "You shall be known as 'bob'"},
+	} {
+		if err := step.session.expect(step.line, step.want); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Logging in with a key takes the character back, powers and all.
+	proven := h.connectAs("root")
+	if output := proven.output(); !strings.Contains(output, "You take back control of root.") {
+		t.Errorf("Logging in with a key didn't take back root, got:\n%v", output)
+	}
+	if err := proven.expect("ban 10.0.0.1 Testing.", "Banned 10.0.0.1"); err != nil {
+		t.Error(err)
+	}
+}
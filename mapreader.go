@@ -2,33 +2,47 @@ package main
 
 import (
 	"fmt"
+	"hash/fnv"
 	"io"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
-func CreateMap(dir string) []*Room {
+func CreateMap(dir string) *Area {
+	area, err := loadMap(dir)
+	if err != nil {
+		log.WithError(err).Fatal("Could not load map.")
+	}
+	return area
+}
+
+// Reads the Area kept in the world directory dir.
+func loadMap(dir string) (*Area, error) {
 	log.WithFields(log.Fields{
-		"map_dir": fmt.Sprintf("./%s/", dir),
+		"map_dir": dir,
 	}).Info("Loading map.")
-	area, err := readMap(fmt.Sprintf("./%s/map.txt", dir))
+	area, err := readMap(filepath.Join(dir, "map.txt"))
 	if err != nil {
-		log.WithError(err).Fatal("Could not load map.")
+		return nil, err
 	}
-	rooms, err := readRooms(fmt.Sprintf("./%s/rooms.txt", dir))
+	rooms, err := readRooms(filepath.Join(dir, "rooms.txt"))
 	if err != nil {
-		log.WithError(err).Fatal("Could not load rooms.")
+		return nil, fmt.Errorf("Could not load rooms: %w", err)
 	}
-	output := area.buildMap(rooms)
+	output := area.buildMap(filepath.Base(dir), rooms)
 	log.WithFields(log.Fields{
-		"map_dir":    fmt.Sprintf("./%s/", dir),
+		"map_dir":    dir,
 		"map_width":  area.width,
 		"map_height": area.height,
-		"no_rooms":   len(output),
+		"no_rooms":   len(output.rooms),
 	}).Info("Map loaded.")
-	return output
+	return output, nil
 }
 
 // The text-based representation of a map ingested from a file.
@@ -145,7 +159,7 @@ func isRoom(symbol string) bool {
 }
 
 // Creates a complex of Room objects from a TextMap and a collection of TextRooms.
-func (tm *TextMap) buildMap(rooms map[string]TextRoom) []*Room {
+func (tm *TextMap) buildMap(name string, rooms *RoomSet) *Area {
 	mapWorker := CreateMapWorker(tm, rooms) // Creates a 'worker' to manage mape creation.
 	for i, symbol := range tm.area {        // For every character in the []string array of the text map
 		if isRoom(symbol) {
@@ -154,8 +168,8 @@ func (tm *TextMap) buildMap(rooms map[string]TextRoom) []*Room {
 			mapWorker.createLink(i)
 		}
 	}
-	mapWorker.joinLinks()          // Connect together the rooms.
-	output := mapWorker.getRooms() // Convert the map of indices to rooms to a flat room array.
+	mapWorker.joinLinks()             // Connect together the rooms.
+	output := mapWorker.getArea(name) // Collect the rooms into an Area.
 	return output
 }
 
@@ -185,10 +199,11 @@ func getEdgeFlags(tm *TextMap, index int, coords Coordinates) (dirFlags Directio
 // MapWorkers coordinate the steps involved in converting a text map into a
 // collection of interconnected
 type MapWorker struct {
-	textMap        *TextMap            // The text map being converted
-	completedRooms map[int]*Room       // A map of indices to Room structures
-	links          []Link              // A list of connections between Room structures
-	rooms          map[string]TextRoom // The 'content' to be loaded into Room structures
+	textMap        *TextMap         // The text map being converted
+	completedRooms map[int]*Room    // A map of indices to Room structures
+	links          []Link           // A list of connections between Room structures
+	rooms          *RoomSet         // The 'content' to be loaded into Room structures
+	doors          map[int][]string // A map of indices to the directions with doors out of that Room
 }
 
 // Links represent connections between Rooms and are built in parallel to
@@ -202,12 +217,13 @@ type Link struct {
 }
 
 // Create a new MapWorker. Probably doesn't need its own function.
-func CreateMapWorker(tm *TextMap, rooms map[string]TextRoom) (mw *MapWorker) {
+func CreateMapWorker(tm *TextMap, rooms *RoomSet) (mw *MapWorker) {
 	mw = &MapWorker{
 		textMap:        tm,
 		links:          []Link{},
 		completedRooms: make(map[int]*Room),
 		rooms:          rooms,
+		doors:          make(map[int][]string),
 	}
 	return mw
 }
@@ -219,22 +235,51 @@ func (mw *MapWorker) joinLinks() {
 		startRoom, startOk := mw.completedRooms[link.start]
 		endRoom, endOk := mw.completedRooms[link.end]
 		if startOk && endOk && (link.direction != BadDir) {
-			connectRoomsCardinally(startRoom, endRoom, link.direction)
+			exit, _ := connectRoomsCardinally(startRoom, endRoom, link.direction)
+			if mw.hasDoor(link.start, link.direction) || mw.hasDoor(link.end, invertDir(link.direction)) {
+				exit.addDoor()
+			}
+		}
+	}
+}
+
+// Returns true if the room at 'index' asked for a door on its exit in
+// Direction dir.
+func (mw *MapWorker) hasDoor(index int, dir Direction) bool {
+	for _, door := range mw.doors[index] {
+		if strings.EqualFold(door, dirToString(dir)) {
+			return true
 		}
 	}
+	return false
 }
 
 // Builds a room at a given index.
+// The room's content comes from the template for its symbol, with any
+// override for its coordinates laid on top. Description variants and flavour
+// lines are picked using a seed derived from the room's position, so the
+// same map always produces the same rooms.
 func (mw *MapWorker) buildRoom(index int) {
 	var output *Room
-	if room, exists := mw.rooms[mw.textMap.area[index]]; exists {
-		output = newUnlinkedRoom(room.Description, room.Title)
+	coords := getCoords(index, mw.textMap.width, mw.textMap.height)
+	if room, exists := mw.rooms.resolve(mw.textMap.area[index], coords); exists {
+		rng := rand.New(rand.NewSource(roomSeed(mw.textMap.area[index], index)))
+		output = newUnlinkedRoom(room.generateDescription(rng), room.Title)
+		mw.doors[index] = room.Doors
 	} else {
 		output = newGenericRoom()
 	}
+	output.coords = coords
 	mw.completedRooms[index] = output
 }
 
+// Produces a stable random seed for the room with 'symbol' at 'index'.
+func roomSeed(symbol string, index int) int64 {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s:%d", symbol, index)
+	return int64(hash.Sum64())
+}
+
 // Creates a Link between either ends of a connection and determines its
 // direction.
 func (mw *MapWorker) createLink(index int) {
@@ -254,32 +299,148 @@ func (mw *MapWorker) createLink(index int) {
 }
 
 // Converts the MapWorker's map of text map indices to Rooms to a flat array
-// of Room structs.
+// of Room structs, ordered by their position on the text map.
 func (mw *MapWorker) getRooms() (output []*Room) {
-	for _, room := range mw.completedRooms {
-		output = append(output, room)
+	indices := []int{}
+	for index := range mw.completedRooms {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		output = append(output, mw.completedRooms[index])
 	}
 	return
 }
 
+// Gathers the MapWorker's Rooms into an Area called 'name', giving each Room
+// its ID.
+func (mw *MapWorker) getArea(name string) *Area {
+	area := newArea(name, mw.textMap.width, mw.textMap.height)
+	for _, room := range mw.getRooms() {
+		area.addRoom(room)
+	}
+	return area
+}
+
 // TextRoom is the serialised format of Room descriptions, etc.
+// A TextRoom with a Symbol is a template used for every occurrence of that
+// symbol on the Text Map. A TextRoom with 'at' coordinates is an override
+// for the single room at that position; any fields it sets replace those of
+// the template.
 type TextRoom struct {
-	Symbol      string `yaml:"symbol"` // Symbol is the single character on the Text Map that this TextRoom will be used for
-	Title       string `yaml:"title"`
-	Description string `yaml:"desc"`
+	Symbol       string      `yaml:"symbol"` // Symbol is the single character on the Text Map that this TextRoom will be used for
+	At           *TextCoords `yaml:"at"`     // At is the position on the Text Map of the room this TextRoom overrides
+	Title        string      `yaml:"title"`
+	Description  string      `yaml:"desc"`
+	Variants     []string    `yaml:"variants"`      // Alternative descriptions, one of which is picked per room
+	Flavour      []string    `yaml:"flavour"`       // Extra lines, some of which are appended to the description
+	FlavourCount int         `yaml:"flavour_count"` // How many flavour lines to append, defaults to one
+	Doors        []string    `yaml:"doors"`         // Directions of exits that have a door across them, e.g. North
+}
+
+// TextCoords is the serialised format of a position on a Text Map.
+type TextCoords struct {
+	X int `yaml:"x"`
+	Y int `yaml:"y"`
+}
+
+// Lays the fields set in 'override' over those of the TextRoom.
+func (tr TextRoom) merge(override TextRoom) TextRoom {
+	if override.Title != "" {
+		tr.Title = override.Title
+	}
+	if override.Description != "" {
+		tr.Description = override.Description
+		tr.Variants = nil
+	}
+	if len(override.Variants) > 0 {
+		tr.Variants = override.Variants
+	}
+	if override.Flavour != nil {
+		tr.Flavour = override.Flavour
+	}
+	if override.FlavourCount != 0 {
+		tr.FlavourCount = override.FlavourCount
+	}
+	if override.Doors != nil {
+		tr.Doors = override.Doors
+	}
+	return tr
+}
+
+// Builds the description of a single room instance, choosing between the
+// TextRoom's description and its variants, then appending flavour lines.
+func (tr TextRoom) generateDescription(rng *rand.Rand) string {
+	descriptions := tr.Variants
+	if tr.Description != "" {
+		descriptions = append([]string{tr.Description}, descriptions...)
+	}
+	var output string
+	if len(descriptions) > 0 {
+		output = descriptions[rng.Intn(len(descriptions))]
+	}
+	count := tr.FlavourCount
+	if count == 0 {
+		count = 1
+	}
+	if count > len(tr.Flavour) {
+		count = len(tr.Flavour)
+	}
+	for _, i := range rng.Perm(len(tr.Flavour))[:count] {
+		output = strings.TrimSpace(output + " " + tr.Flavour[i])
+	}
+	return output
+}
+
+// RoomSet holds the TextRooms read from a rooms file, split into templates
+// keyed by symbol and overrides keyed by position.
+type RoomSet struct {
+	templates map[string]TextRoom
+	overrides map[Coordinates]TextRoom
+}
+
+// Finds the content for the room with 'symbol' at 'coords'. Returns false if
+// there is neither a template nor an override for it.
+func (rs *RoomSet) resolve(symbol string, coords Coordinates) (TextRoom, bool) {
+	room, exists := rs.templates[symbol]
+	if override, ok := rs.overrides[coords]; ok {
+		return room.merge(override), true
+	}
+	return room, exists
 }
 
 // This collects a set of serialised room descriptions and symbols from a file
-// at location 'dir' and creates a map of symbol to TextRoom.
-func readRooms(dir string) (rooms map[string]TextRoom, err error) {
-	rooms = make(map[string]TextRoom)
-	if rawRooms, err := os.Open(dir); err == nil {
-		defer rawRooms.Close()
-		decoder := yaml.NewDecoder(rawRooms)
+// at location 'dir' and creates a RoomSet of templates and overrides.
+func readRooms(dir string) (rooms *RoomSet, err error) {
+	rooms = &RoomSet{
+		templates: make(map[string]TextRoom),
+		overrides: make(map[Coordinates]TextRoom),
+	}
+	rawRooms, err := os.Open(dir)
+	if err != nil {
+		return rooms, err
+	}
+	defer rawRooms.Close()
+	decoder := yaml.NewDecoder(rawRooms)
+	for {
 		var rawRoom TextRoom
-		for decoder.Decode(&rawRoom) == nil {
-			rooms[rawRoom.Symbol] = rawRoom
+		if err := decoder.Decode(&rawRoom); err == io.EOF {
+			break
+		} else if err != nil {
+			return rooms, err
+		}
+		if rawRoom.FlavourCount < 0 {
+			where := fmt.Sprintf("'%v'", rawRoom.Symbol)
+			if rawRoom.At != nil {
+				where = fmt.Sprintf("at %v,%v", rawRoom.At.X, rawRoom.At.Y)
+			}
+			return rooms, fmt.Errorf("Room %v has a negative flavour_count of %v.", where, rawRoom.FlavourCount)
+		}
+		if rawRoom.At != nil {
+			rooms.overrides[Coordinates{rawRoom.At.X, rawRoom.At.Y}] = rawRoom
+		} else {
+			rooms.templates[rawRoom.Symbol] = rawRoom
 		}
 	}
-	return rooms, err
+	return rooms, nil
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MCCP2, the MUD Client Compression Protocol, compresses everything the
+// server sends with zlib once the client agrees to telnet option 86.
+const telnetCOMPRESS2 byte = 86
+
+// mccpConn is a telnet connection that compresses its output once the
+// client has agreed to MCCP2. It counts the bytes written to it and the
+// bytes actually sent, so players can see what compression is saving them.
+type mccpConn struct {
+	net.Conn
+	lock       sync.Mutex
+	compressor *zlib.Writer // Nil while output isn't being compressed
+	written    atomic.Int64 // Bytes of output, before compression
+	sent       atomic.Int64 // Bytes sent over the connection
+	closeOnce  sync.Once
+}
+
+func newMCCPConn(conn net.Conn) *mccpConn {
+	return &mccpConn{Conn: conn}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	io.Writer
+	count *atomic.Int64
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.Writer.Write(p)
+	cw.count.Add(int64(n))
+	return n, err
+}
+
+func (mc *mccpConn) Write(p []byte) (int, error) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	mc.written.Add(int64(len(p)))
+	if mc.compressor == nil {
+		return countingWriter{mc.Conn, &mc.sent}.Write(p)
+	}
+	n, err := mc.compressor.Write(p)
+	if err != nil {
+		return n, err
+	}
+	// Flush straight away, as players are waiting on every line.
+	return n, mc.compressor.Flush()
+}
+
+// Tells the client compression is starting, then compresses everything
+// sent after.
+func (mc *mccpConn) startCompression() {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	if mc.compressor != nil {
+		return
+	}
+	countingWriter{mc.Conn, &mc.sent}.Write(telnetSubnegotiation(telnetCOMPRESS2))
+	mc.compressor = zlib.NewWriter(countingWriter{mc.Conn, &mc.sent})
+}
+
+// Ends the compressed stream, so output goes back to being sent as it is.
+func (mc *mccpConn) stopCompression() {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	if mc.compressor == nil {
+		return
+	}
+	mc.compressor.Close()
+	mc.compressor = nil
+}
+
+func (mc *mccpConn) compressing() bool {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	return mc.compressor != nil
+}
+
+// Describes how much compression has saved on the connection so far.
+func (mc *mccpConn) stats() string {
+	written, sent := mc.written.Load(), mc.sent.Load()
+	saved := 0.0
+	if written > 0 {
+		saved = 100 * float64(written-sent) / float64(written)
+	}
+	return fmt.Sprintf("%v bytes of output sent as %v bytes, saving %.0f%%.", written, sent, saved)
+}
+
+// Ends the compressed stream cleanly before closing the connection.
+func (mc *mccpConn) Close() (err error) {
+	mc.closeOnce.Do(func() {
+		mc.stopCompression()
+		log.WithFields(log.Fields{
+			"remote_address": mc.RemoteAddr().String(),
+			"bytes_written":  mc.written.Load(),
+			"bytes_sent":     mc.sent.Load(),
+		}).Info("Connection output totals.")
+		err = mc.Conn.Close()
+	})
+	return
+}
+
+// Shows the player whether their output is being compressed, and how much
+// it's saving.
+func compressionCommand() Command {
+	return Command{
+		names: []string{"compression", "mccp"},
+		action: func(m *Mob, args string) ReadiedCommand {
+			return func() bool {
+				user, err := getUserFromMob(m)
+				if err != nil {
+					return false
+				}
+				mc, ok := user.Conn.(*mccpConn)
+				switch {
+				case !ok:
+					m.tell("Your connection doesn't support compression.\n")
+				case mc.compressing():
+					m.tell("Your output is being compressed. " + mc.stats() + "\n")
+				default:
+					m.tell("Your output isn't being compressed, your client hasn't asked for MCCP.\n")
+				}
+				return true
+			}
+		},
+	}
+}
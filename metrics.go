@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// serverMetrics counts what the server does, for the /metrics endpoint.
+type serverMetrics struct {
+	sync.Mutex
+	commands     map[string]int64 // Commands run, by verb
+	ticks        int64            // Beats of the world
+	tickDuration time.Duration    // Time spent on all the beats, not counting sleeping between them
+	lastTick     time.Duration    // Time spent on the most recent beat
+}
+
+var metrics = serverMetrics{commands: make(map[string]int64)}
+
+// Counts a command being run. Verbs are the first name of the command, so
+// that aliases and typos don't each get their own count.
+func (sm *serverMetrics) countCommand(verb string) {
+	sm.Lock()
+	defer sm.Unlock()
+	sm.commands[verb]++
+}
+
+// Records how long a beat of the world took.
+func (sm *serverMetrics) observeTick(took time.Duration) {
+	sm.Lock()
+	defer sm.Unlock()
+	sm.ticks++
+	sm.tickDuration += took
+	sm.lastTick = took
+}
+
+// Writes every metric in the Prometheus text exposition format.
+func writeMetrics(w io.Writer) {
+	usersLock.Lock()
+	connected := len(users)
+	queued, longest := 0, 0
+	for _, user := range users {
+		user.Mob.queueLock.Lock()
+		length := len(user.Mob.cmdQueue)
+		user.Mob.queueLock.Unlock()
+		queued += length
+		if length > longest {
+			longest = length
+		}
+	}
+	usersLock.Unlock()
+	world.Lock()
+	mobs := len(world.things)
+	world.Unlock()
+
+	metric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n%v %v\n", name, help, name, kind, name, value)
+	}
+	metric("sud_connections", "gauge", "Connections open, including those not yet logged in.", connectionCount.Load())
+	metric("sud_connected_users", "gauge", "Players logged in.", connected)
+	metric("sud_linkdead_mobs", "gauge", "Characters waiting in the world for their players to reconnect.", len(linkdeadList()))
+	metric("sud_mobs", "gauge", "Mobs in the world, players and NPCs.", mobs)
+	metric("sud_rooms", "gauge", "Rooms in the world.", len(world.rooms))
+	metric("sud_queued_commands", "gauge", "Commands waiting in every player's queue.", queued)
+	metric("sud_queue_length_max", "gauge", "Commands waiting in the longest player queue.", longest)
+	metric("go_goroutines", "gauge", "Goroutines that currently exist.", runtime.NumGoroutine())
+
+	metrics.Lock()
+	defer metrics.Unlock()
+	metric("sud_tick_last_seconds", "gauge", "Time the most recent beat of the world took.", metrics.lastTick.Seconds())
+	fmt.Fprintf(w, "# HELP sud_tick_duration_seconds Time spent on beats of the world.\n# TYPE sud_tick_duration_seconds summary\n")
+	fmt.Fprintf(w, "sud_tick_duration_seconds_sum %v\nsud_tick_duration_seconds_count %v\n", metrics.tickDuration.Seconds(), metrics.ticks)
+	fmt.Fprintf(w, "# HELP sud_commands_total Commands run, by verb.\n# TYPE sud_commands_total counter\n")
+	verbs := []string{}
+	for verb := range metrics.commands {
+		verbs = append(verbs, verb)
+	}
+	sort.Strings(verbs)
+	for _, verb := range verbs {
+		fmt.Fprintf(w, "sud_commands_total{verb=%q} %v\n", verb, metrics.commands[verb])
+	}
+}
+
+// ServerStatus is the serialised format of the /status endpoint.
+type ServerStatus struct {
+	Server  string         `json:"server"`
+	Uptime  string         `json:"uptime"`
+	Players []PlayerStatus `json:"players"`
+	Rooms   []RoomStatus   `json:"rooms"`
+}
+
+// PlayerStatus describes one player in the game.
+type PlayerStatus struct {
+	Name     string `json:"name"`
+	Room     string `json:"room"`
+	Address  string `json:"address,omitempty"` // Empty for linkdead players, and left out of /status
+	Idle     string `json:"idle,omitempty"`
+	AFK      bool   `json:"afk"`
+	Linkdead bool   `json:"linkdead"`
+}
+
+// RoomStatus describes one occupied Room.
+type RoomStatus struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Contents []string `json:"contents"`
+}
+
+// Describes the players in the game and the Rooms with anything in them.
+func serverStatus() ServerStatus {
+	status := ServerStatus{
+		Server:  config.ServerName,
+		Uptime:  world.uptime().Round(time.Second).String(),
+		Players: []PlayerStatus{},
+		Rooms:   []RoomStatus{},
+	}
+	usersLock.Lock()
+	for _, user := range users {
+		status.Players = append(status.Players, PlayerStatus{
+			Name:    user.Mob.name,
+			Room:    user.Mob.location.id,
+			Address: user.Conn.RemoteAddr().String(),
+			Idle:    user.idleFor().Round(time.Second).String(),
+			AFK:     user.Mob.afk.Load(),
+		})
+	}
+	usersLock.Unlock()
+	for _, mob := range linkdeadList() {
+		status.Players = append(status.Players, PlayerStatus{Name: mob.name, Room: mob.location.id, AFK: mob.afk.Load(), Linkdead: true})
+	}
+	sort.Slice(status.Players, func(i, j int) bool { return status.Players[i].Name < status.Players[j].Name })
+	for _, room := range world.rooms {
+		room.RLock()
+		if len(room.contents) > 0 {
+			contents := []string{}
+			for _, thing := range room.contents {
+				contents = append(contents, thing.getName())
+			}
+			status.Rooms = append(status.Rooms, RoomStatus{ID: room.id, Name: room.name, Contents: contents})
+		}
+		room.RUnlock()
+	}
+	return status
+}
+
+// Builds the handlers for the admin HTTP listener.
+func adminHandler() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		// Anyone who can reach the endpoint can read it, so players'
+		// addresses are only given out by the API.
+		status := serverStatus()
+		for i := range status.Players {
+			status.Players[i].Address = ""
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	})
+	mux.HandleFunc("/api/", apiHandler)
+	return mux
+}
+
+// Starts serving metrics, status and the admin API on addr.
+func serveAdmin(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Infof("Admin endpoint is listening on port %v", addr)
+	go func() {
+		log.WithError(http.Serve(listener, adminHandler())).Fatal("Admin endpoint stopped.")
+	}()
+	return nil
+}
+
+// Fetches and parses the metrics at url, the way Prometheus would, so a
+// running server can be checked without one. Returns each sample's value
+// by its name and labels, e.g. `sud_commands_total{verb="look"}`.
+func scrapeMetrics(url string) (map[string]float64, error) {
+	response, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Scrape of '%v' failed: %v", url, response.Status)
+	}
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(response.Body)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		split := strings.LastIndex(text, " ")
+		if split < 0 {
+			return nil, fmt.Errorf("Line %v of the metrics has no value: %q", line, text)
+		}
+		value, err := strconv.ParseFloat(text[split+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Line %v of the metrics has a bad value: %w", line, err)
+		}
+		samples[text[:split]] = value
+	}
+	return samples, scanner.Err()
+}
+
+// Scrapes the metrics from a running server at addr and prints them, sorted
+// by name. Used with the -scrape flag to check a server's admin endpoint.
+func printScrape(addr string, out io.Writer) error {
+	samples, err := scrapeMetrics("http://" + addr + "/metrics")
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "%v = %v\n", name, samples[name])
+	}
+	return nil
+}
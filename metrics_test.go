@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Starts a Harness with a player called alice who has looked around, and
+// returns the admin endpoint serving it.
+func newMetricsHarness(t *testing.T) *httptest.Server {
+	h, err := newHarness("testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := h.connect()
+	for _, line := range []string{"alice", "look", "2e", "nonsense"} {
+		if _, err := s.do(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(adminHandler())
+	t.Cleanup(func() {
+		server.Close()
+		h.close()
+	})
+	return server
+}
+
+func TestScrapeMetrics(t *testing.T) {
+	server := newMetricsHarness(t)
+	metrics.Lock()
+	looks := metrics.commands["look"]
+	metrics.Unlock()
+	samples, err := scrapeMetrics(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		want float64
+	}{
+		{"sud_connected_users", 1},
+		{"sud_mobs", 1},
+		{"sud_rooms", 8},
+		{"sud_queued_commands", 0},
+		{`sud_commands_total{verb="look"}`, float64(looks)},
+	} {
+		if got, found := samples[test.name]; !found || got != test.want {
+			t.Errorf("%v was %v, want %v.", test.name, got, test.want)
+		}
+	}
+	for _, name := range []string{`sud_commands_total{verb="speedwalk"}`, `sud_commands_total{verb="unknown"}`, "go_goroutines"} {
+		if samples[name] < 1 {
+			t.Errorf("%v was %v, want at least 1.", name, samples[name])
+		}
+	}
+
+	if _, err := scrapeMetrics(server.URL + "/missing"); err == nil {
+		t.Error("Scraping a missing page didn't fail.")
+	}
+}
+
+func TestPrintScrape(t *testing.T) {
+	server := newMetricsHarness(t)
+	var out bytes.Buffer
+	if err := printScrape(strings.TrimPrefix(server.URL, "http://"), &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !strings.Contains(out.String(), "\nsud_connected_users = 1\n") {
+		t.Errorf("Connected users missing from the scrape:\n%v", out.String())
+	}
+	for i := 1; i < len(lines); i++ {
+		if lines[i-1] > lines[i] {
+			t.Errorf("Scrape isn't sorted: %q comes before %q.", lines[i-1], lines[i])
+		}
+	}
+}
+
+func TestStatusLeavesOutAddresses(t *testing.T) {
+	server := newMetricsHarness(t)
+	response, err := http.Get(server.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var status ServerStatus
+	if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Players) != 1 || status.Players[0].Name != "alice" {
+		t.Fatalf("Players were %+v, want alice.", status.Players)
+	}
+	if status.Players[0].Address != "" {
+		t.Errorf("Status gave alice's address, %v.", status.Players[0].Address)
+	}
+}
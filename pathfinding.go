@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Finds the shortest route from Room start to Room end, using a breadth
+// first search over open exits. Returns the exits to take, in order.
+func findPath(start, end *Room) ([]*Exit, error) {
+	if start == end {
+		return []*Exit{}, nil
+	}
+	// Maps each Room reached to the exit used to reach it.
+	cameFrom := map[*Room]*Exit{start: nil}
+	frontier := []*Room{start}
+	for len(frontier) > 0 {
+		room := frontier[0]
+		frontier = frontier[1:]
+		for _, exit := range room.exits {
+			next := exit.getDestination()
+			if _, seen := cameFrom[next]; seen || !exit.isOpen() {
+				continue
+			}
+			cameFrom[next] = exit
+			if next == end {
+				return walkBack(cameFrom, end), nil
+			}
+			frontier = append(frontier, next)
+		}
+	}
+	return nil, fmt.Errorf("There is no way to get to %v from here.", end.name)
+}
+
+// Follows the exits recorded during a search back from Room end to where the
+// search began, returning them in the order they should be taken.
+func walkBack(cameFrom map[*Room]*Exit, end *Room) (path []*Exit) {
+	for exit := cameFrom[end]; exit != nil; exit = cameFrom[exit.room] {
+		path = append([]*Exit{exit}, path...)
+	}
+	return
+}
+
+// Turns a path into a readable list of directions, e.g. "East, South".
+func describePath(path []*Exit) string {
+	if len(path) == 0 {
+		return "You're already there."
+	}
+	names := []string{}
+	for _, exit := range path {
+		names = append(names, exit.getPrimaryName())
+	}
+	return strings.Join(names, ", ")
+}
+
+// Finds the Room a Mob is referring to by 'target', which is either a Room ID
+// or the name of a Room. Players can only find Rooms they have visited.
+func (m *Mob) findRoom(target string) (*Room, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil, fmt.Errorf("Where do you want to go?")
+	}
+	var partial *Room
+	for _, room := range m.world.rooms {
+		if !m.builder && !m.hasVisited(room) {
+			continue
+		}
+		if room.id == target || strings.EqualFold(room.name, target) {
+			return room, nil
+		}
+		if partial == nil && strings.Contains(strings.ToLower(room.name), strings.ToLower(target)) {
+			partial = room
+		}
+	}
+	if partial != nil {
+		return partial, nil
+	}
+	return nil, fmt.Errorf("You don't know of anywhere called '%v'.", target)
+}
+
+// Finds a path from the Mob's location to the Room it calls 'target'.
+func (m *Mob) pathTo(target string) ([]*Exit, error) {
+	destination, err := m.findRoom(target)
+	if err != nil {
+		return nil, err
+	}
+	return findPath(m.location, destination)
+}
+
+// Queues up moves through each exit in path, one per pulse. Returns false
+// if the queue has no room for them.
+func (m *Mob) follow(path []*Exit) bool {
+	moves := []ReadiedCommand{}
+	for _, exit := range path {
+		moves = append(moves, m.chained(generateExitAction(exit)(m, "")))
+	}
+	return m.enqueue(moves...)
+}
+
+// Sends the Mob towards Room target. Used by anything that wants a Mob to
+// make its own way somewhere, without going through a command.
+func (m *Mob) walkTo(target *Room) error {
+	path, err := findPath(m.location, target)
+	if err != nil {
+		return err
+	}
+	if !m.follow(path) {
+		return fmt.Errorf("Too many commands are queued to walk to '%v'.", target.name)
+	}
+	return nil
+}
@@ -1,18 +1,39 @@
 package main
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
 	log "github.com/sirupsen/logrus"
 )
 
 type Mob struct {
 	location    *Room
+	moveLock    sync.Mutex // Guards location, which other goroutines read through getLocation
 	name        string
 	commands    []Command
 	world       *World
 	pulse       <-chan interface{}
 	cmdQueue    []func() bool
-	print       chan<- string
+	queueLock   sync.Mutex
+	print       chan Output // Output for the Mob's player, taken by its connection to be written
+	stopOutput  chan bool   // Closed once the connection stops taking output
+	outputLock  sync.Mutex  // Guards print and stopOutput
 	description string
+	hp          int
+	maxHP       int
+	visited     map[string]bool // IDs of the Rooms this Mob has been in
+	visitedLock sync.Mutex
+	builder     bool
+	admin       bool
+	prefs       Preferences
+	prefsLock   sync.Mutex
+	npc         bool        // NPCs are Mobs with no user, and are saved with the world rather than an account
+	respawnAt   string      // ID of the Room to spawn in, if not the world's starting room
+	linkdead    atomic.Bool // Whether the Mob's player has lost their connection
+	afk         atomic.Bool // Whether the Mob's player has been idle long enough to be away from keyboard
 }
 
 type Pulsable interface {
@@ -28,12 +49,22 @@ func newMob() (p *Mob) {
 		name:        "",
 		commands:    basicCommands(),
 		description: "A generic looking person.",
+		hp:          20,
+		maxHP:       20,
+		visited:     make(map[string]bool),
 	}
 }
 
-func (m *Mob) spawn(name string, world *World) error {
+// Puts the Mob called name into the world, showing it the Room it starts in
+// wrapped to width columns. The Mob's player isn't in the list of users yet,
+// so their width is passed in.
+func (m *Mob) spawn(name string, world *World, width int) error {
 	m.name = name
+	m.world = world
 	start := world.getStartRoom()
+	if room := world.getRoom(m.respawnAt); room != nil {
+		start = room
+	}
 	pulse, err := world.registerThing(m)
 	if err != nil {
 		log.WithError(err).Errorf("Failed to create mob: %s", name)
@@ -42,7 +73,7 @@ func (m *Mob) spawn(name string, world *World) error {
 	m.pulse = pulse
 	go m.beat()
 	start.enterRoom(m)
-	m.print <- start.displayRoom()
+	m.tell(start.displayRoom(width))
 	log.WithFields(log.Fields{
 		"mob_name":      m.name,
 		"starting_room": m.location.name,
@@ -50,13 +81,81 @@ func (m *Mob) spawn(name string, world *World) error {
 	return nil
 }
 
+// Creates an NPC called name in Room room. NPCs are never connected, so
+// their output is thrown away.
+func spawnNPC(name, description string, room *Room, world *World) (*Mob, error) {
+	m := newMob()
+	m.npc = true
+	m.description = description
+	m.respawnAt = room.id
+	return m, m.spawn(name, world, defaultWindowWidth)
+}
+
 func (m *Mob) despawn() {
 	world.roomEmit(m.name+" departs from the game.\n", m.location)
 	m.location.leaveRoom(m)
+	m.world.unregisterThing(m.pulse)
 }
 
-func (m *Mob) connect(print chan<- string) {
-	m.print = print
+// Output is a message for a Mob's player, passed to their connection in the
+// order it was sent in.
+type Output struct {
+	Text   string // Text for the player to read, with colour markup
+	Prompt bool   // Whether Text is a prompt, whose end MUD clients are told of
+	GMCP   string // A GMCP message for the player's client, sent instead of text
+}
+
+// Starts passing the Mob's output to write, one message at a time, until
+// the Mob is connected somewhere else or disconnected.
+func (m *Mob) connect(write func(o Output)) {
+	print, stop := make(chan Output), make(chan bool)
+	m.outputLock.Lock()
+	if m.stopOutput != nil {
+		close(m.stopOutput)
+	}
+	m.print, m.stopOutput = print, stop
+	m.outputLock.Unlock()
+	go func() {
+		for {
+			select {
+			case o := <-print:
+				write(o)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stops passing on the Mob's output. Anything it's told from then on is
+// thrown away.
+func (m *Mob) disconnect() {
+	m.outputLock.Lock()
+	defer m.outputLock.Unlock()
+	if m.stopOutput != nil {
+		close(m.stopOutput)
+		m.print, m.stopOutput = nil, nil
+	}
+}
+
+// Sends msg to the Mob's player, waiting until it has been taken to be
+// written, unless the Mob isn't connected.
+func (m *Mob) tell(msg string) {
+	m.deliver(Output{Text: msg})
+}
+
+// Sends o to the Mob's player, as with tell.
+func (m *Mob) deliver(o Output) {
+	m.outputLock.Lock()
+	print, stop := m.print, m.stopOutput
+	m.outputLock.Unlock()
+	if print == nil {
+		return
+	}
+	select {
+	case print <- o:
+	case <-stop:
+	}
 }
 
 func (m *Mob) getDescription() string {
@@ -67,19 +166,150 @@ func (m *Mob) getName() string {
 	return m.name
 }
 
+// Returns the Room the Mob is in, for use away from the Mob's own beat.
+func (m *Mob) getLocation() *Room {
+	m.moveLock.Lock()
+	defer m.moveLock.Unlock()
+	return m.location
+}
+
+// Records that the Mob has been in Room r.
+func (m *Mob) visit(r *Room) {
+	m.visitedLock.Lock()
+	defer m.visitedLock.Unlock()
+	m.visited[r.id] = true
+}
+
+func (m *Mob) hasVisited(r *Room) bool {
+	m.visitedLock.Lock()
+	defer m.visitedLock.Unlock()
+	return m.visited[r.id]
+}
+
+// Returns how many of the Rooms in Area a the Mob has visited, out of the
+// total number of Rooms in it.
+func (m *Mob) explored(a *Area) (visited, total int) {
+	for _, room := range a.rooms {
+		if m.hasVisited(room) {
+			visited++
+		}
+	}
+	return visited, len(a.rooms)
+}
+
+// Summarises the Mob's progress through each of the world's areas.
+func (m *Mob) explorationReport() (output string) {
+	output = "Exploration:\n"
+	for _, area := range m.world.areas {
+		visited, total := m.explored(area)
+		percent := 0
+		if total > 0 {
+			percent = visited * 100 / total
+		}
+		output += fmt.Sprintf("  %-20v %3v%% (%v/%v rooms)\n", area.name, percent, visited, total)
+	}
+	return
+}
+
+// Returns the number of columns the Mob's output is wrapped to, or the
+// default width if no one is controlling it.
+func (m *Mob) textWidth() int {
+	if user, err := getUserFromMob(m); err == nil {
+		return user.textWidth()
+	}
+	return defaultWindowWidth
+}
+
+// Adds commands to the end of the Mob's queue, to be run one per pulse.
+// Returns false, adding none of them, if they'd take the queue past
+// maxQueuedCommands.
+func (m *Mob) enqueue(commands ...ReadiedCommand) bool {
+	m.queueLock.Lock()
+	defer m.queueLock.Unlock()
+	if len(m.cmdQueue)+len(commands) > maxQueuedCommands {
+		return false
+	}
+	m.cmdQueue = append(m.cmdQueue, commands...)
+	return true
+}
+
+// Takes the next command off the front of the Mob's queue. Returns nil if
+// the queue is empty.
+func (m *Mob) dequeue() (nextCommand ReadiedCommand) {
+	m.queueLock.Lock()
+	defer m.queueLock.Unlock()
+	if len(m.cmdQueue) >= 1 {
+		if len(m.cmdQueue) >= 2 {
+			nextCommand, m.cmdQueue = m.cmdQueue[0], m.cmdQueue[1:]
+		} else {
+			nextCommand, m.cmdQueue = m.cmdQueue[0], []ReadiedCommand{}
+		}
+	}
+	return
+}
+
+// Empties the Mob's queue, returning how many commands were dropped.
+func (m *Mob) clearQueue() int {
+	m.queueLock.Lock()
+	defer m.queueLock.Unlock()
+	dropped := len(m.cmdQueue)
+	m.cmdQueue = []ReadiedCommand{}
+	return dropped
+}
+
+// Wraps a queued movement so that if it fails, everything queued after it
+// is abandoned rather than carrying on from the wrong place.
+func (m *Mob) chained(step ReadiedCommand) ReadiedCommand {
+	return func() bool {
+		if step() {
+			return true
+		}
+		if m.clearQueue() > 0 {
+			m.tell("You stop moving.\n")
+		}
+		return false
+	}
+}
+
 func (m *Mob) beat() {
 	for {
 		select {
-		case _ = <-m.pulse:
-			if len(m.cmdQueue) >= 1 {
-				var nextCommand ReadiedCommand
-				if len(m.cmdQueue) >= 2 {
-					nextCommand, m.cmdQueue = m.cmdQueue[0], m.cmdQueue[1:]
-				} else {
-					nextCommand, m.cmdQueue = m.cmdQueue[0], []ReadiedCommand{}
-				}
+		case pulse, ok := <-m.pulse:
+			if !ok {
+				return
+			}
+			if nextCommand := m.dequeue(); nextCommand != nil {
 				nextCommand()
+				m.showPrompt()
+			}
+			// Pulses from World.step are waited on until they're handled.
+			if handled, ok := pulse.(*sync.WaitGroup); ok {
+				handled.Done()
 			}
 		}
 	}
 }
+
+// Opens or closes the door in 'direction' out of the Mob's location.
+func (m *Mob) setDoor(direction string, closed bool) bool {
+	verb, state := "open", "open"
+	if closed {
+		verb, state = "close", "closed"
+	}
+	exit := m.location.findExit(strings.TrimSpace(direction))
+	if exit == nil {
+		m.tell(fmt.Sprintf("There's no exit that way to %v.\n", verb))
+		return false
+	}
+	if exit.door == nil {
+		m.tell(fmt.Sprintf("There's no door to the %v.\n", exit.getPrimaryName()))
+		return false
+	}
+	if exit.door.closed.Swap(closed) == closed {
+		m.tell(fmt.Sprintf("The door to the %v is already %v.\n", exit.getPrimaryName(), state))
+		return false
+	}
+	world.roomEmit(fmt.Sprintf("%v %vs the door to the %v.\n", m.name, verb, exit.getPrimaryName()), m.location)
+	world.roomEmit(fmt.Sprintf("The door to the %v %vs.\n", exit.destination.getPrimaryName(), verb), exit.getDestination())
+	return true
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The prompt players see unless they choose their own.
+const defaultPrompt = "{W}<%hhp %l [%e]>{x} "
+
+// Replaces each prompt token with what it stands for:
+//
+//	%h - hit points
+//	%H - maximum hit points
+//	%l - the name of the Mob's location
+//	%e - the first letter of each exit out of the Mob's location
+//	%t - the time on the server
+//	%% - a literal %
+func (m *Mob) expandPrompt(format string) string {
+	exits := ""
+	for _, exit := range m.location.exits {
+		exits += string(exit.getPrimaryName()[0])
+	}
+	replacer := strings.NewReplacer(
+		"%h", fmt.Sprint(m.hp),
+		"%H", fmt.Sprint(m.maxHP),
+		"%l", escapeMarkup(m.location.name),
+		"%e", exits,
+		"%t", m.world.clock.Now().Format("15:04"),
+		"%%", "%",
+	)
+	return replacer.Replace(format)
+}
+
+// Sends the Mob its prompt, marked with a telnet go ahead so that MUD
+// clients know where it ends. Anything GMCP clients need to know about
+// the command that's just run is sent with it.
+func (m *Mob) showPrompt() {
+	if m.npc || m.location == nil {
+		return
+	}
+	m.updateGMCP()
+	format := m.getPreferences().Prompt
+	if format == "" {
+		format = defaultPrompt
+	}
+	m.deliver(Output{Text: m.expandPrompt(format), Prompt: true})
+}
+
+// Lets players choose their prompt:
+//
+//	prompt            - show the current prompt's format
+//	prompt <format>   - use a new prompt, see expandPrompt for its tokens
+//	prompt default    - go back to the default prompt
+func promptCommand() Command {
+	return Command{
+		names: []string{"prompt"},
+		action: func(p *Mob, format string) ReadiedCommand {
+			return func() bool {
+				switch strings.TrimSpace(format) {
+				case "":
+					current := p.getPreferences().Prompt
+					if current == "" {
+						current = defaultPrompt
+					}
+					p.tell(fmt.Sprintf("Your prompt is: %v\n"+
+						"Tokens: %%h hp, %%H max hp, %%l location, %%e exits, %%t time, %%%% a %% sign.\n",
+						escapeMarkup(current)))
+					return true
+				case "default":
+					format = ""
+				}
+				p.updatePreferences(func(prefs *Preferences) {
+					prefs.Prompt = format
+				})
+				p.tell("Your prompt has been changed.\n")
+				return true
+			}
+		},
+	}
+}
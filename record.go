@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SessionEvent is the serialised format of one line of a session recording.
+type SessionEvent struct {
+	Tick      int        `json:"tick"`                // Beats of the world since the session connected
+	Kind      string     `json:"kind"`                // One of the event kinds below
+	Text      string     `json:"text,omitempty"`      // What was typed or sent, without colour
+	Width     int        `json:"width,omitempty"`     // Width of the player's window when they typed the input
+	Height    int        `json:"height,omitempty"`    // Height of the player's window when they typed the input
+	Account   *Account   `json:"account,omitempty"`   // The player's account as they logged in
+	Character *Character `json:"character,omitempty"` // The player's character as they logged in
+}
+
+// Kinds of SessionEvent.
+const (
+	eventConnect = "connect" // The session started; Text is the account it's already logged in to, over SSH
+	eventInput   = "input"   // The player typed a line
+	eventOutput  = "output"  // The player was sent something
+	eventLogin   = "login"   // The player logged in to a character
+)
+
+// sessionRecorder writes a recording of a session to a file as it happens,
+// one SessionEvent to a line. A nil sessionRecorder records nothing, so
+// sessions that aren't being recorded needn't check.
+type sessionRecorder struct {
+	sync.Mutex
+	file    *os.File // Nil once the recording is closed
+	encoder *json.Encoder
+	start   int // The world's beat when the session connected
+}
+
+// Makes recording file names safe from the characters in addresses.
+var recordingNameReplacer = strings.NewReplacer(":", "-", "[", "", "]", "", "/", "-")
+
+// Starts recording the session on conn into config.RecordDir, returning nil
+// if recording is off or the recording can't be created.
+func startRecording(conn net.Conn, account string) *sessionRecorder {
+	if config.RecordDir == "" {
+		return nil
+	}
+	name := fmt.Sprintf("%v-%v.jsonl", world.clock.Now().Format("20060102-150405"), recordingNameReplacer.Replace(conn.RemoteAddr().String()))
+	// Recordings hold everything players typed and the addresses they came
+	// from, so only the server's own user can read them.
+	if err := os.MkdirAll(config.RecordDir, 0o700); err != nil {
+		log.WithError(err).Error("Could not create the recording directory.")
+		return nil
+	}
+	file, err := os.OpenFile(filepath.Join(config.RecordDir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		log.WithError(err).Error("Could not start recording session.")
+		return nil
+	}
+	sr := &sessionRecorder{file: file, encoder: json.NewEncoder(file), start: world.beats()}
+	sr.record(SessionEvent{Kind: eventConnect, Text: account})
+	return sr
+}
+
+// Adds event to the recording, stamped with the current beat.
+func (sr *sessionRecorder) record(event SessionEvent) {
+	if sr == nil {
+		return
+	}
+	event.Tick = world.beats() - sr.start
+	sr.Lock()
+	defer sr.Unlock()
+	if sr.file == nil {
+		return
+	}
+	if err := sr.encoder.Encode(event); err != nil {
+		log.WithError(err).WithField("file", sr.file.Name()).Error("Could not record session.")
+	}
+}
+
+// Records that the user has logged in, with their account and character
+// as they were, so a replay can start them off the same way.
+func (u *User) recordLogin() {
+	if u.recorder == nil {
+		return
+	}
+	account, err := store.LoadAccount(u.Mob.name)
+	if err != nil {
+		log.WithError(err).Errorf("Could not load account '%v' to record.", u.Mob.name)
+		return
+	}
+	// Replays don't log in over SSH.
+	account.SSHKeys = nil
+	character := u.Mob.character()
+	u.recorder.record(SessionEvent{Kind: eventLogin, Account: &account, Character: &character})
+}
+
+func (sr *sessionRecorder) close() {
+	if sr == nil {
+		return
+	}
+	sr.Lock()
+	defer sr.Unlock()
+	sr.file.Close()
+	sr.file = nil
+}
+
+// Reads the session recording at path.
+func readRecording(path string) ([]SessionEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	events := []SessionEvent{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var event SessionEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("Line %v of '%v' isn't a session event: %w", line, path, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(events) == 0 || events[0].Kind != eventConnect {
+		return nil, fmt.Errorf("'%v' isn't a session recording.", path)
+	}
+	return events, nil
+}
+
+// Replays the session recorded at path against a fresh copy of the world
+// in worldDir, through a Harness, returning where the output differs from
+// the recording. Each input is typed on the beat it was recorded on, and
+// the output before it compared with what was recorded before it. Anyone
+// else who was in the game at the time isn't, so anything they did will
+// show up as a difference.
+func replaySession(path, worldDir string) (differences []string, err error) {
+	events, err := readRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := newHarness(worldDir)
+	if err != nil {
+		return nil, err
+	}
+	defer h.close()
+	// Players start off as they were when they were recorded.
+	for _, event := range events {
+		if event.Kind != eventLogin {
+			continue
+		}
+		if event.Account != nil {
+			if err := store.SaveAccount(*event.Account); err != nil {
+				return nil, err
+			}
+		}
+		if event.Character != nil {
+			if err := store.SaveCharacter(*event.Character); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	s := h.connectAs(events[0].Text)
+	expected, since := "", "on connecting"
+	compare := func() {
+		differences = append(differences, diffOutput(since, expected, s.output())...)
+		expected = ""
+	}
+	for _, event := range events {
+		switch event.Kind {
+		case eventOutput:
+			expected += event.Text
+		case eventInput:
+			h.stepTo(event.Tick)
+			compare()
+			if event.Width > 0 && event.Height > 0 {
+				s.resize(event.Width, event.Height)
+			}
+			if err := s.send(event.Text); err != nil {
+				differences = append(differences, fmt.Sprintf("The session was disconnected before %q was typed on beat %v.", event.Text, event.Tick))
+				return differences, nil
+			}
+			since = fmt.Sprintf("after %q on beat %v", event.Text, event.Tick)
+		}
+	}
+	h.stepTo(events[len(events)-1].Tick)
+	compare()
+	return differences, nil
+}
+
+// Most lines of output diffOutput lines up with each other. Longer output
+// is shown whole on both sides.
+const maxDiffLines = 2000
+
+// Compares the output expected with the output actually sent, returning
+// nothing if they're the same, or else a heading followed by the lines that
+// differ: "-" for lines only expected, "+" for lines only sent.
+func diffOutput(since, expected, actual string) []string {
+	if expected == actual {
+		return nil
+	}
+	a, b := strings.SplitAfter(expected, "\n"), strings.SplitAfter(actual, "\n")
+	output := []string{fmt.Sprintf("Output %v differs:", since)}
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		for _, line := range a {
+			output = append(output, "- "+strings.TrimSuffix(line, "\n"))
+		}
+		for _, line := range b {
+			output = append(output, "+ "+strings.TrimSuffix(line, "\n"))
+		}
+		return output
+	}
+	// common[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:].
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				common[i][j] = common[i+1][j+1] + 1
+			case common[i+1][j] >= common[i][j+1]:
+				common[i][j] = common[i+1][j]
+			default:
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			output = append(output, "- "+strings.TrimSuffix(a[i], "\n"))
+			i++
+		default:
+			output = append(output, "+ "+strings.TrimSuffix(b[j], "\n"))
+			j++
+		}
+	}
+	return output
+}
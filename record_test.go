@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffOutput(t *testing.T) {
+	for _, test := range []struct {
+		name, expected, actual string
+		want                   []string
+	}{
+		{"same", "a\nb\n", "a\nb\n", nil},
+		{"changed", "a\nb\nc\n", "a\nB\nc\n", []string{"- b", "+ B"}},
+		{"added", "a\nc\n", "a\nb\nc\n", []string{"+ b"}},
+		{"removed", "a\nb\nc\n", "a\nc\n", []string{"- b"}},
+		{"unfinished line", "a\nb", "a\nb\n", []string{"- b", "+ b", "+ "}},
+		{"nothing sent", "a\n", "", []string{"- a"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffOutput("on beat 1", test.expected, test.actual)
+			if test.want == nil {
+				if got != nil {
+					t.Errorf("Got %q, want no differences.", got)
+				}
+				return
+			}
+			want := append([]string{"Output on beat 1 differs:"}, test.want...)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Got %q, want %q.", got, want)
+			}
+		})
+	}
+}
+
+func TestDiffOutputTooLongToLineUp(t *testing.T) {
+	long := strings.Repeat("line\n", maxDiffLines)
+	got := diffOutput("on beat 1", long+"a\n", long+"b\n")
+	// Both sides are shown whole, each with the empty line after the last
+	// newline.
+	if want := 1 + 2*(maxDiffLines+2); len(got) != want {
+		t.Errorf("Got %v lines, want %v.", len(got), want)
+	}
+}
+
+// Plays a session through a Harness with recording on, and returns the
+// path of the recording.
+func recordSession(t *testing.T, lines []string) string {
+	h, err := newHarness("testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	dir := t.TempDir()
+	config.RecordDir = dir
+	defer func() { config.RecordDir = "" }()
+	s := h.connect()
+	for _, line := range lines {
+		if _, err := s.do(line); err != nil {
+			t.Fatal(err)
+		}
+		h.step(2)
+	}
+	s.close()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("Found recordings %v, %v, want one.", paths, err)
+	}
+	return paths[0]
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	// The forest is left out, as its descriptions are picked at random.
+	path := recordSession(t, []string{"alice", "look", "e", "open s", "s", "say hello", "2w", "who"})
+	if name := filepath.Base(path); !strings.HasPrefix(name, harnessEpoch.Format("20060102-150405")) {
+		t.Errorf("Recording was named %v, not from the world's clock.", name)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("Recording was created with %v, want it readable only by its owner.", info.Mode())
+	}
+	events, err := readRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]int{}
+	for _, event := range events {
+		kinds[event.Kind]++
+	}
+	if kinds[eventConnect] != 1 || kinds[eventLogin] != 1 || kinds[eventInput] != 8 || kinds[eventOutput] == 0 {
+		t.Errorf("Recorded %v.", kinds)
+	}
+
+	differences, err := replaySession(path, "testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(differences) > 0 {
+		t.Errorf("Replay differed from the recording:\n%v", strings.Join(differences, "\n"))
+	}
+
+	// A recording the game no longer matches shows up as a difference.
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := strings.Replace(string(raw), "alice says: hello", "alice says: goodbye", 1)
+	if err := os.WriteFile(path, []byte(changed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	differences, err = replaySession(path, "testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"- alice says: goodbye", "+ alice says: hello"}
+	if len(differences) != 3 || !strings.HasPrefix(differences[0], `Output after "say hello" on beat `) || !reflect.DeepEqual(differences[1:], want) {
+		t.Errorf("Replaying a changed recording gave:\n%v", strings.Join(differences, "\n"))
+	}
+}
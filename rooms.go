@@ -8,16 +8,33 @@ import (
 
 type Room struct {
 	sync.RWMutex
+	id          string
 	description string
 	name        string
 	exits       []*Exit
 	commands    []Command
 	contents    []Thing
+	area        *Area
+	coords      Coordinates
 }
 
-func (r *Room) getDescription() string {
-	padding := strings.Repeat("-", len(r.description))
-	return fmt.Sprintf("\n|%v|\n%v\n%v\n%v\n\n", r.name, padding, r.description, padding)
+// Returns the Room's title and description, boxed in by rules as wide as the
+// description will be once wrapped to width columns.
+func (r *Room) getDescription(width int) string {
+	r.RLock()
+	defer r.RUnlock()
+	// The rules are as wide as the description once it's been wrapped.
+	ruleWidth := 0
+	for _, line := range strings.Split(wrapText(r.description, width), "\n") {
+		if length := visibleLength(line); length > ruleWidth {
+			ruleWidth = length
+		}
+	}
+	if width > 0 && ruleWidth > width {
+		ruleWidth = width
+	}
+	padding := strings.Repeat("-", ruleWidth)
+	return fmt.Sprintf("\n|{title}%v{x}|\n%v\n%v\n%v\n\n", r.name, padding, r.description, padding)
 }
 
 func (r *Room) getExitCommands() (commands []Command) {
@@ -28,13 +45,37 @@ func (r *Room) getExitCommands() (commands []Command) {
 	return
 }
 
+// Returns true if one of the Room's exits leads to 'other'.
+func (r *Room) leadsTo(other *Room) bool {
+	for _, exit := range r.exits {
+		if exit.getDestination() == other {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the exit called 'name', or nil if the Room has no such exit.
+func (r *Room) findExit(name string) *Exit {
+	for _, exit := range r.exits {
+		if exit.hasName(name) {
+			return exit
+		}
+	}
+	return nil
+}
+
 func (r *Room) listExits() string {
 	var exitString string
 	for _, exit := range r.exits {
-		exitString += exit.getPrimaryName() + ", "
+		exitString += exit.getPrimaryName()
+		if !exit.isOpen() {
+			exitString += " (closed)"
+		}
+		exitString += ", "
 	}
 	if len(r.exits) > 0 {
-		return fmt.Sprintf("Visible Exits: %v\n", exitString)
+		return fmt.Sprintf("Visible Exits: {exits}%v{x}\n", exitString)
 	}
 	return "You can't see any exits."
 }
@@ -44,17 +85,27 @@ func (r *Room) showContents() (output string) {
 		output = fmt.Sprintf("You see:\n")
 	}
 	for _, thing := range r.contents {
-		output = fmt.Sprintf("%v\n- %v\n", output, thing.getName())
+		name := thing.getName()
+		if mob, ok := thing.(*Mob); ok {
+			name += mob.statusTags()
+		}
+		output = fmt.Sprintf("%v\n- %v\n", output, name)
 	}
 	return
 }
 
-func (r *Room) displayRoom() string {
-	return fmt.Sprintf("%v\n%v\n%v", r.getDescription(), r.showContents(), r.listExits())
+func (r *Room) displayRoom(width int) string {
+	return fmt.Sprintf("%v\n%v\n%v", r.getDescription(width), r.showContents(), r.listExits())
 }
 
 func newUnlinkedRoom(description string, name string) *Room {
-	return &Room{sync.RWMutex{}, description, name, []*Exit{}, []Command{}, []Thing{}}
+	return &Room{
+		description: description,
+		name:        name,
+		exits:       []*Exit{},
+		commands:    []Command{},
+		contents:    []Thing{},
+	}
 }
 
 func newGenericRoom() *Room {
@@ -72,11 +123,19 @@ func (r *Room) updateCommands() {
 	r.commands = r.getExitCommands()
 }
 
-func (r *Room) enterRoom(p *Mob) bool {
-	p.location = r
+// Puts a Thing in the Room.
+func (r *Room) addThing(t Thing) {
 	r.RWMutex.Lock()
-	r.contents = append(r.contents, p)
+	r.contents = append(r.contents, t)
 	r.RWMutex.Unlock()
+}
+
+func (r *Room) enterRoom(p *Mob) bool {
+	p.moveLock.Lock()
+	p.location = r
+	p.moveLock.Unlock()
+	p.visit(r)
+	r.addThing(p)
 	// Later on, if something stops the movement, return false.
 	return true
 }
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Screens are the blocks of text shown to players as they connect. Each is
+// kept in a file in the world directory so it can be changed without a
+// restart.
+type Screen struct {
+	name     string // What admins call the screen in game
+	file     string // File name within the world directory
+	fallback string // Shown if the file doesn't exist
+}
+
+var (
+	// Shown to new connections, before they pick a name.
+	greetingScreen = Screen{"greeting", "greeting.txt", "Welcome to %server%!\n"}
+	// Shown once a player has logged in.
+	motdScreen = Screen{"motd", "motd.txt", ""}
+	// Shown after the MOTD, and whenever a player asks for the news.
+	newsScreen = Screen{"news", "news.txt", ""}
+	screens    = []Screen{greetingScreen, motdScreen, newsScreen}
+)
+
+// Returns where the Screen is kept. The MOTD can be moved elsewhere in the
+// server's config.
+func (s Screen) path() string {
+	if s.name == motdScreen.name && config.MOTDFile != "" {
+		return config.MOTDFile
+	}
+	return filepath.Join(config.WorldDir, s.file)
+}
+
+// Returns the Screen's text without any placeholders filled in.
+func (s Screen) raw() string {
+	text, err := os.ReadFile(s.path())
+	if os.IsNotExist(err) {
+		return s.fallback
+	} else if err != nil {
+		log.WithError(err).Errorf("Could not read the %v screen.", s.name)
+		return s.fallback
+	}
+	return string(text)
+}
+
+// Returns the Screen's text as seen by the player called name, with the
+// placeholders filled in. Name is empty for players who haven't logged in.
+//
+//	%server%  - the server's name
+//	%players% - the number of players online
+//	%uptime%  - how long the server has been running
+//	%name%    - the player's name
+func (s Screen) render(name string) string {
+	usersLock.Lock()
+	players := len(users)
+	usersLock.Unlock()
+	replacer := strings.NewReplacer(
+		"%server%", config.ServerName,
+		"%players%", fmt.Sprint(players),
+		"%uptime%", world.uptime().Round(time.Second).String(),
+		"%name%", name,
+	)
+	return replacer.Replace(s.raw())
+}
+
+// Appends a line of text to the Screen's file.
+func (s Screen) addLine(line string) error {
+	text := s.raw()
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return os.WriteFile(s.path(), []byte(text+line+"\n"), 0o644)
+}
+
+// Empties the Screen's file.
+func (s Screen) clear() error {
+	return os.WriteFile(s.path(), []byte{}, 0o644)
+}
+
+func findScreen(name string) (Screen, bool) {
+	for _, screen := range screens {
+		if strings.EqualFold(screen.name, name) {
+			return screen, true
+		}
+	}
+	return Screen{}, false
+}
+
+// Shows the MOTD and news to a player who has just logged in as name.
+func (m *Mob) showLoginScreens(name string) {
+	for _, screen := range []Screen{motdScreen, newsScreen} {
+		if text := screen.render(name); text != "" {
+			m.tell(text)
+		}
+	}
+}
+
+func motdCommand() Command {
+	return Command{
+		names: []string{"motd"},
+		action: func(p *Mob, _ string) ReadiedCommand {
+			return func() bool {
+				p.tell(motdScreen.render(p.name))
+				return true
+			}
+		},
+	}
+}
+
+func newsCommand() Command {
+	return Command{
+		names: []string{"news"},
+		action: func(p *Mob, _ string) ReadiedCommand {
+			return func() bool {
+				if news := newsScreen.render(p.name); news != "" {
+					p.tell(news)
+				} else {
+					p.tell("There's no news.\n")
+				}
+				return true
+			}
+		},
+	}
+}
+
+// Lets admins read and change the screens:
+//
+//	screen                     - list the screens
+//	screen <name>              - show a screen's text, placeholders and all
+//	screen <name> add <text>   - add a line to the end of a screen
+//	screen <name> clear        - empty a screen
+func screenCommand() Command {
+	return Command{
+		names: []string{"screen"},
+		action: func(p *Mob, args string) ReadiedCommand {
+			return func() bool {
+				if !p.admin {
+					p.tell("Only admins can change the screens.\n")
+					return false
+				}
+				name, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+				if name == "" {
+					names := []string{}
+					for _, screen := range screens {
+						names = append(names, screen.name)
+					}
+					p.tell(fmt.Sprintf("Screens: %v\n", strings.Join(names, ", ")))
+					return true
+				}
+				screen, ok := findScreen(name)
+				if !ok {
+					p.tell(fmt.Sprintf("There's no screen called '%v'.\n", name))
+					return false
+				}
+				action, text, _ := strings.Cut(strings.TrimSpace(rest), " ")
+				var err error
+				switch strings.ToLower(action) {
+				case "":
+					p.tell(fmt.Sprintf("--- %v (%v) ---\n%v", screen.name, screen.path(), screen.raw()))
+					return true
+				case "add":
+					err = screen.addLine(text)
+				case "clear":
+					err = screen.clear()
+				default:
+					p.tell("Use 'screen <name> add <text>' or 'screen <name> clear'.\n")
+					return false
+				}
+				if err != nil {
+					log.WithError(err).Errorf("Could not change the %v screen.", screen.name)
+					p.tell("The screen could not be saved.\n")
+					return false
+				}
+				log.WithFields(log.Fields{
+					"mob_name": p.name,
+					"screen":   screen.name,
+					"action":   action,
+				}).Info("Screen changed.")
+				audit(streamAdmin, p.name, "Changed the %v screen: %v %v", screen.name, action, text)
+				p.tell(fmt.Sprintf("The %v screen has been updated.\n", screen.name))
+				return true
+			}
+		},
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WorldSnapshot is the serialised format of the parts of the World that
+// change while it runs. Everything else is rebuilt from the map files.
+// Players aren't included, they are saved to their accounts.
+type WorldSnapshot struct {
+	Saved time.Time      `yaml:"saved"`
+	Rooms []RoomSnapshot `yaml:"rooms"`
+}
+
+// RoomSnapshot is the serialised format of a single Room's dynamic state.
+type RoomSnapshot struct {
+	ID    string          `yaml:"id"`
+	Doors map[string]bool `yaml:"doors,omitempty"` // Exit names to whether the door across them is closed
+	Items []ThingSnapshot `yaml:"items,omitempty"`
+	NPCs  []ThingSnapshot `yaml:"npcs,omitempty"`
+}
+
+// ThingSnapshot is the serialised format of an Item or NPC.
+type ThingSnapshot struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"desc"`
+}
+
+// Captures the state of the Room. Returns false if there is nothing in it
+// worth saving.
+func (r *Room) snapshot() (RoomSnapshot, bool) {
+	output := RoomSnapshot{ID: r.id}
+	for _, exit := range r.exits {
+		if exit.door != nil {
+			if output.Doors == nil {
+				output.Doors = make(map[string]bool)
+			}
+			output.Doors[exit.getPrimaryName()] = !exit.isOpen()
+		}
+	}
+	r.RLock()
+	for _, thing := range r.contents {
+		switch t := thing.(type) {
+		case *Item:
+			output.Items = append(output.Items, ThingSnapshot{t.name, t.description})
+		case *Mob:
+			if t.npc {
+				output.NPCs = append(output.NPCs, ThingSnapshot{t.name, t.description})
+			}
+		}
+	}
+	r.RUnlock()
+	return output, len(output.Doors)+len(output.Items)+len(output.NPCs) > 0
+}
+
+func (w *World) snapshot() WorldSnapshot {
+	output := WorldSnapshot{Saved: w.clock.Now()}
+	for _, room := range w.rooms {
+		if rs, ok := room.snapshot(); ok {
+			output.Rooms = append(output.Rooms, rs)
+		}
+	}
+	return output
+}
+
+// Puts the World back into the state recorded in the snapshot held in
+// Store st. A missing snapshot isn't an error, the World just starts fresh.
+// The World must be running, so that restored NPCs can be spawned.
+func (w *World) restoreSnapshot(st Store) error {
+	snapshot, err := st.LoadSnapshot()
+	if errors.Is(err, ErrNotFound) {
+		log.Info("No world snapshot found, starting fresh.")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Could not load world snapshot: %w", err)
+	}
+	for _, rs := range snapshot.Rooms {
+		room := w.getRoom(rs.ID)
+		if room == nil {
+			log.WithField("room_id", rs.ID).Warn("Snapshot refers to a room that no longer exists.")
+			continue
+		}
+		for name, closed := range rs.Doors {
+			if exit := room.findExit(name); exit != nil && exit.door != nil {
+				exit.door.closed.Store(closed)
+			}
+		}
+		for _, item := range rs.Items {
+			room.addThing(newItem(item.Name, item.Description))
+		}
+		for _, npc := range rs.NPCs {
+			if _, err := spawnNPC(npc.Name, npc.Description, room, w); err != nil {
+				return err
+			}
+		}
+	}
+	log.WithFields(log.Fields{
+		"saved":    snapshot.Saved,
+		"no_rooms": len(snapshot.Rooms),
+	}).Info("World restored.")
+	return nil
+}
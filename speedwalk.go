@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The most moves a single speedwalk can queue up.
+const maxSpeedwalk = 50
+
+// Letters used for each direction in a speedwalk.
+var speedwalkDirs = map[rune]Direction{
+	'n': North,
+	'e': East,
+	's': South,
+	'w': West,
+}
+
+// Expands a speedwalk string, e.g. "3n2e s", into the directions it stands
+// for, e.g. North, North, North, East, East, South. Each direction letter can
+// be preceded by a number of times to repeat it, and spaces are ignored.
+// Returns false if the input isn't a valid speedwalk. So that words like
+// "see" aren't taken for one, a speedwalk needs a count or more than one
+// word.
+func parseSpeedwalk(input string) (directions []string, ok bool) {
+	if len(strings.Fields(input)) < 2 && !strings.ContainsAny(input, "0123456789") {
+		return nil, false
+	}
+	count := ""
+	for _, r := range strings.ToLower(input) {
+		switch {
+		case unicode.IsSpace(r):
+			if count != "" {
+				return nil, false
+			}
+		case unicode.IsDigit(r):
+			count += string(r)
+		default:
+			dir, isDir := speedwalkDirs[r]
+			if !isDir {
+				return nil, false
+			}
+			repeat := 1
+			if count != "" {
+				var err error
+				if repeat, err = strconv.Atoi(count); err != nil || repeat > maxSpeedwalk {
+					return nil, false
+				}
+				count = ""
+			}
+			for i := 0; i < repeat; i++ {
+				directions = append(directions, dirToString(dir))
+			}
+			if len(directions) > maxSpeedwalk {
+				return nil, false
+			}
+		}
+	}
+	if count != "" || len(directions) == 0 {
+		return nil, false
+	}
+	return directions, true
+}
+
+// Queues up a move in each of 'directions', one per pulse. If a move fails,
+// the rest are dropped. Returns false if the queue has no room for them.
+func (m *Mob) queueMoves(directions []string) bool {
+	moves := []ReadiedCommand{}
+	for _, direction := range directions {
+		direction := direction
+		moves = append(moves, m.chained(func() bool {
+			exit := m.location.findExit(direction)
+			if exit == nil {
+				m.tell(fmt.Sprintf("You can't go %v from here.\n", direction))
+				return false
+			}
+			return generateExitAction(exit)(m, "")()
+		}))
+	}
+	return m.enqueue(moves...)
+}
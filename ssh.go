@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// Loads the SSH server's private key from path, generating and saving a new
+// one if there isn't one yet. Keeping the key means clients can check they're
+// talking to the same server each time.
+func loadHostKey(path string) (ssh.Signer, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(key, config.ServerName)
+		if err != nil {
+			return nil, err
+		}
+		raw = pem.EncodeToMemory(block)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, raw, 0o600); err != nil {
+			return nil, err
+		}
+		log.WithField("path", path).Info("Generated a new SSH host key.")
+	} else if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(raw)
+}
+
+// Returns the configuration for the SSH server. A client that logs in as an
+// account with a public key listed on it goes straight into the game as that
+// account. Anyone else is let in to pick a name, as they would over telnet,
+// unless they're logging in as an account with keys but without one.
+func sshServerConfig(hostKey ssh.Signer) *ssh.ServerConfig {
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !validName(meta.User()) {
+				return nil, errors.New("Not an account name.")
+			}
+			account, err := store.LoadAccount(meta.User())
+			if err != nil {
+				return nil, err
+			}
+			if !hasKey(account, key) {
+				return nil, errors.New("Key not listed on the account.")
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"account": account.Name}}, nil
+		},
+		// Asks no questions, so clients without a key can still connect.
+		KeyboardInteractiveCallback: func(meta ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			if validName(meta.User()) {
+				if account, err := store.LoadAccount(meta.User()); err == nil && len(account.SSHKeys) > 0 {
+					return nil, errors.New("The account needs one of its keys.")
+				}
+			}
+			return &ssh.Permissions{}, nil
+		},
+	}
+	serverConfig.AddHostKey(hostKey)
+	return serverConfig
+}
+
+// Returns true if key is one of the account's SSH keys.
+func hasKey(account Account, key ssh.PublicKey) bool {
+	for _, line := range account.SSHKeys {
+		listed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err == nil && bytes.Equal(listed.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Starts accepting SSH connections on addr.
+func serveSSH(addr string) error {
+	hostKey, err := loadHostKey(config.SSHHostKey)
+	if err != nil {
+		return fmt.Errorf("Could not load SSH host key: %w", err)
+	}
+	serverConfig := sshServerConfig(hostKey)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Infof("SSH is listening on port %v", addr)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.WithError(err).Fatal("Error accepting SSH connection.")
+			}
+			// Banned and surplus clients are turned away before the
+			// handshake, which is the costly part.
+			if !admitConnection(conn) {
+				conn.Close()
+				continue
+			}
+			go func() {
+				defer releaseConnection(conn)
+				handleSSH(conn, serverConfig)
+			}()
+		}
+	}()
+	return nil
+}
+
+// Runs the SSH protocol over conn. Only one session, the game, is allowed
+// on each connection.
+func handleSSH(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	// Don't let a client hang about without finishing the handshake.
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	server, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		log.WithError(err).WithField("remote_address", conn.RemoteAddr().String()).Debug("SSH handshake failed.")
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	defer server.Close()
+	go ssh.DiscardRequests(requests)
+
+	account := server.Permissions.Extensions["account"]
+	started := false
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "Only sessions are supported.")
+			continue
+		}
+		if started {
+			newChannel.Reject(ssh.Prohibited, "Only one session is allowed per connection.")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			log.WithError(err).Warn("Could not accept SSH session.")
+			return
+		}
+		started = true
+		session := &sshConn{channel: channel, conn: conn, server: server}
+		go session.serve(requests, account)
+	}
+}
+
+// sshConn is an SSH session, presented as a connection so it can be run
+// through the same session pipeline as telnet. Sessions with a terminal are
+// given line editing, as SSH terminals don't echo or edit lines themselves.
+type sshConn struct {
+	channel  ssh.Channel
+	conn     net.Conn // The TCP connection the session is carried over
+	server   *ssh.ServerConn
+	terminal *term.Terminal // Nil if the client didn't ask for a terminal, never changed once the shell starts
+	pending  []byte         // Input read from the terminal but not yet returned
+	width    atomic.Int32
+	height   atomic.Int32
+	sizeLock sync.Mutex // Guards setting up the terminal and changing its size
+}
+
+// ptyRequest is the payload of a pty-req request, RFC 4254 section 6.2.
+type ptyRequest struct {
+	Term          string
+	Columns, Rows uint32
+	Width, Height uint32
+	Modes         string
+}
+
+// windowChange is the payload of a window-change request, RFC 4254
+// section 6.7.
+type windowChange struct {
+	Columns, Rows uint32
+	Width, Height uint32
+}
+
+// Handles the session's requests, starting the game once the client asks
+// for a shell.
+func (sc *sshConn) serve(requests <-chan *ssh.Request, account string) {
+	shell := make(chan bool, 1)
+	go func() {
+		started := false
+		for req := range requests {
+			ok := false
+			switch req.Type {
+			case "pty-req":
+				// The terminal is only set up before the shell starts, so
+				// the game never sees it change.
+				var pty ptyRequest
+				if !started && sc.terminal == nil && ssh.Unmarshal(req.Payload, &pty) == nil {
+					sc.sizeLock.Lock()
+					sc.terminal = term.NewTerminal(sc.channel, "")
+					sc.sizeLock.Unlock()
+					sc.setWindowSize(int(pty.Columns), int(pty.Rows))
+					ok = true
+				}
+			case "window-change":
+				var change windowChange
+				if ssh.Unmarshal(req.Payload, &change) == nil {
+					sc.setWindowSize(int(change.Columns), int(change.Rows))
+					ok = true
+				}
+			case "shell":
+				if ok = !started; ok {
+					started = true
+					shell <- true
+				}
+			}
+			if req.WantReply {
+				req.Reply(ok, nil)
+			}
+		}
+		close(shell)
+	}()
+	if !<-shell {
+		sc.Close()
+		return
+	}
+	handleConnection(sc, false, account)
+}
+
+func (sc *sshConn) setWindowSize(width, height int) {
+	sc.sizeLock.Lock()
+	defer sc.sizeLock.Unlock()
+	sc.width.Store(int32(width))
+	sc.height.Store(int32(height))
+	if sc.terminal != nil && width > 0 && height > 0 {
+		sc.terminal.SetSize(width, height)
+	}
+}
+
+// Returns the size of the client's terminal, zero for any dimension it
+// hasn't reported.
+func (sc *sshConn) windowSize() (width, height int) {
+	return int(sc.width.Load()), int(sc.height.Load())
+}
+
+func (sc *sshConn) Read(p []byte) (int, error) {
+	if sc.terminal == nil {
+		return sc.channel.Read(p)
+	}
+	if len(sc.pending) == 0 {
+		line, err := sc.terminal.ReadLine()
+		if err != nil {
+			return 0, err
+		}
+		sc.pending = []byte(line + "\n")
+	}
+	n := copy(p, sc.pending)
+	sc.pending = sc.pending[n:]
+	return n, nil
+}
+
+func (sc *sshConn) Write(p []byte) (int, error) {
+	if sc.terminal == nil {
+		return sc.channel.Write(p)
+	}
+	return sc.terminal.Write(p)
+}
+
+// Ends the session, and with it the connection.
+func (sc *sshConn) Close() error {
+	sc.channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+	sc.channel.Close()
+	return sc.server.Close()
+}
+
+func (sc *sshConn) LocalAddr() net.Addr {
+	return sc.conn.LocalAddr()
+}
+
+func (sc *sshConn) RemoteAddr() net.Addr {
+	return sc.conn.RemoteAddr()
+}
+
+// Deadlines are set on the TCP connection underneath, so a session that
+// goes idle drops the whole connection.
+func (sc *sshConn) SetDeadline(t time.Time) error {
+	return sc.conn.SetDeadline(t)
+}
+
+func (sc *sshConn) SetReadDeadline(t time.Time) error {
+	return sc.conn.SetReadDeadline(t)
+}
+
+func (sc *sshConn) SetWriteDeadline(t time.Time) error {
+	return sc.conn.SetWriteDeadline(t)
+}
+
+// Lists, adds and removes the public keys that can log in to the player's
+// account over SSH.
+func sshKeyCommand() Command {
+	return Command{
+		names: []string{"sshkey", "sshkeys"},
+		action: func(m *Mob, args string) func() bool {
+			return func() bool {
+				action, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+				rest = strings.TrimSpace(rest)
+				var msg string
+				err := updateAccount(m.name, func(account *Account) {
+					if action == "add" || action == "remove" {
+						if msg = sshKeyRefusal(m, *account); msg != "" {
+							return
+						}
+					}
+					switch action {
+					case "", "list":
+						msg = describeSSHKeys(account.SSHKeys)
+					case "add":
+						key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+						if err != nil {
+							msg = "That isn't a public key. Paste a line from your id_ed25519.pub or similar file.\n"
+							return
+						}
+						line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+						if comment != "" {
+							line += " " + comment
+						}
+						account.SSHKeys = append(account.SSHKeys, line)
+						msg = fmt.Sprintf("Added the key. You can now log in with 'ssh %v@<server>'.\n", m.name)
+					case "remove":
+						n, err := strconv.Atoi(rest)
+						if err != nil || n < 1 || n > len(account.SSHKeys) {
+							msg = "Give the number of the key to remove, from 'sshkey list'.\n"
+							return
+						}
+						account.SSHKeys = append(account.SSHKeys[:n-1], account.SSHKeys[n:]...)
+						msg = "Removed the key.\n"
+					default:
+						msg = "Usage: sshkey [list | add <public key> | remove <number>]\n"
+					}
+				})
+				if err != nil {
+					log.WithError(err).Errorf("Could not update SSH keys for '%v'.", m.name)
+					msg = "Your keys could not be changed, please try again later.\n"
+				}
+				m.tell(msg)
+				return true
+			}
+		},
+	}
+}
+
+// Returns why the Mob's player can't change the SSH keys on account, or ""
+// if they can. Once an account has keys, only someone who logged in with
+// one of them can change them. Anyone can type an admin's name, so admins'
+// keys are only ever provisioned through the store.
+func sshKeyRefusal(m *Mob, account Account) string {
+	if user, err := getUserFromMob(m); err == nil && user.authenticated {
+		return ""
+	}
+	if account.Admin {
+		return "An admin's SSH keys can only be set up by the server's operators.\n"
+	}
+	if len(account.SSHKeys) > 0 {
+		return "Log in with one of your SSH keys to change them.\n"
+	}
+	return ""
+}
+
+// Lists keys, numbered for 'sshkey remove'.
+func describeSSHKeys(keys []string) string {
+	if len(keys) == 0 {
+		return "You have no SSH keys. Add one with 'sshkey add <public key>'.\n"
+	}
+	var b strings.Builder
+	b.WriteString("Your SSH keys:\n")
+	for i, line := range keys {
+		kind, rest, _ := strings.Cut(line, " ")
+		_, comment, _ := strings.Cut(rest, " ")
+		if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err == nil {
+			fmt.Fprintf(&b, "  %v. %v %v %v\n", i+1, kind, ssh.FingerprintSHA256(key), comment)
+		}
+	}
+	return b.String()
+}
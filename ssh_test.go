@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestChangingSSHKeysNeedsProof(t *testing.T) {
+	h, err := newHarness("testmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	if err := store.SaveAccount(Account{Name: "root", Admin: true}); err != nil {
+		t.Fatal(err)
+	}
+	const key = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+
+	typed := h.connect()
+	admin := h.connect()
+	for _, step := range []struct {
+		session *Session
+		line    string
+		want    string
+	}{
+		// A new player can add their first key, but then has to log in
+		// with it to change their keys again.
+		{typed, "alice", "You shall be known as 'alice'"},
+		{typed, "sshkey add " + key, "Added the key."},
+		{typed, "sshkey add " + key, "Log in with one of your SSH keys to change them."},
+		{typed, "sshkey remove 1", "Log in with one of your SSH keys to change them."},
+		{typed, "sshkey list", "Your SSH keys:"},
+		// Someone who types an admin's name can't give it a key.
+		{admin, "root", "You shall be known as 'root'"},
+		{admin, "sshkey add " + key, "An admin's SSH keys can only be set up by the server's operators."},
+	} {
+		if err := step.session.expect(step.line, step.want); err != nil {
+			t.Error(err)
+		}
+	}
+	if account, err := store.LoadAccount("root"); err != nil || len(account.SSHKeys) > 0 {
+		t.Errorf("root's account was left as %+v, %v.", account, err)
+	}
+
+	proven := h.connectAs("alice")
+	if err := proven.expect("sshkey remove 1", "Removed the key."); err != nil {
+		t.Error(err)
+	}
+}
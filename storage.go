@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNotFound is returned by a Store asked for something it doesn't have.
+var ErrNotFound = errors.New("Not found.")
+
+// Store is implemented by each of the ways the game's persistent data can
+// be kept. Names of accounts and characters are matched ignoring case.
+type Store interface {
+	LoadAccount(name string) (Account, error)
+	SaveAccount(account Account) error
+	ListAccounts() ([]string, error)
+
+	LoadCharacter(name string) (Character, error)
+	SaveCharacter(character Character) error
+	ListCharacters() ([]string, error)
+
+	LoadSnapshot() (WorldSnapshot, error)
+	SaveSnapshot(snapshot WorldSnapshot) error
+
+	// Returns the ban list, which is empty until a ban is saved.
+	LoadBans() ([]Ban, error)
+	SaveBans(bans []Ban) error
+
+	AppendLog(entry LogEntry) error
+	// Returns the log entries in stream about player, oldest first, those
+	// made at the same time in the order they were appended. An empty stream
+	// or player matches all of them.
+	ReadLogs(stream, player string) ([]LogEntry, error)
+
+	Close() error
+}
+
+// LogEntry is the serialised format of a single line in one of the game's
+// log streams.
+type LogEntry struct {
+	Time    time.Time `yaml:"time" json:"time"`
+	Stream  string    `yaml:"stream" json:"stream"`
+	Player  string    `yaml:"player" json:"player"`
+	Message string    `yaml:"message" json:"message"`
+}
+
+// Names of the kinds of Store that can be opened.
+const (
+	storeFile   = "file"
+	storeSQLite = "sqlite"
+)
+
+// Opens the Store of the given kind, kept at path. An empty path uses the
+// default location for that kind.
+func openStore(kind, path string) (Store, error) {
+	switch kind {
+	case storeFile:
+		if path == "" {
+			path = "save"
+		}
+		return openFileStore(path)
+	case storeSQLite:
+		if path == "" {
+			path = "save/game.db"
+		}
+		return openSQLiteStore(path)
+	}
+	return nil, fmt.Errorf("Unknown storage backend '%v'.", kind)
+}
+
+// Opens a Store described as "kind:path", e.g. "file:save".
+func openStoreSpec(spec string) (Store, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	return openStore(kind, path)
+}
+
+// Puts entries in the order ReadLogs returns them in, given them in the
+// order they were appended.
+func sortLogs(entries []LogEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+}
+
+// Identifies a LogEntry regardless of the time zone its time was read back
+// in, so entries from different Stores can be matched up.
+type logKey struct {
+	time                    int64
+	stream, player, message string
+}
+
+func (e LogEntry) key() logKey {
+	return logKey{e.Time.UnixNano(), e.Stream, e.Player, e.Message}
+}
+
+// Returns account as every Store gives it back, so it can be compared with
+// one loaded from a different kind of Store. Empty lists and maps may come
+// back as nil or as empty, depending on the Store.
+func normalAccount(account Account) Account {
+	if len(account.SSHKeys) == 0 {
+		account.SSHKeys = nil
+	}
+	if len(account.Preferences.Theme) == 0 {
+		account.Preferences.Theme = nil
+	}
+	return account
+}
+
+// Returns character as every Store gives it back, as with normalAccount.
+// Stores may also give the Rooms visited back in a different order.
+func normalCharacter(character Character) Character {
+	if len(character.Visited) == 0 {
+		character.Visited = nil
+	} else {
+		character.Visited = append([]string(nil), character.Visited...)
+		sort.Strings(character.Visited)
+	}
+	return character
+}
+
+// Copies everything held in Store from into Store to, then reads it back to
+// check nothing was lost on the way. Log entries already in Store to are
+// left alone, so a migration can safely be run again.
+func migrateStore(from, to Store) error {
+	accounts, err := from.ListAccounts()
+	if err != nil {
+		return err
+	}
+	for _, name := range accounts {
+		account, err := from.LoadAccount(name)
+		if err != nil {
+			return err
+		}
+		if err := to.SaveAccount(account); err != nil {
+			return err
+		}
+		if copied, err := to.LoadAccount(name); err != nil || !reflect.DeepEqual(normalAccount(copied), normalAccount(account)) {
+			return fmt.Errorf("Account '%v' did not migrate cleanly: %v", name, err)
+		}
+	}
+	characters, err := from.ListCharacters()
+	if err != nil {
+		return err
+	}
+	for _, name := range characters {
+		character, err := from.LoadCharacter(name)
+		if err != nil {
+			return err
+		}
+		if err := to.SaveCharacter(character); err != nil {
+			return err
+		}
+		if copied, err := to.LoadCharacter(name); err != nil || !reflect.DeepEqual(normalCharacter(copied), normalCharacter(character)) {
+			return fmt.Errorf("Character '%v' did not migrate cleanly: %v", name, err)
+		}
+	}
+	snapshot, err := from.LoadSnapshot()
+	if err == nil {
+		if err := to.SaveSnapshot(snapshot); err != nil {
+			return err
+		}
+		if copied, err := to.LoadSnapshot(); err != nil || !reflect.DeepEqual(copied.Rooms, snapshot.Rooms) {
+			return fmt.Errorf("World snapshot did not migrate cleanly: %v", err)
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	bans, err := from.LoadBans()
+	if err != nil {
+		return err
+	}
+	if err := to.SaveBans(bans); err != nil {
+		return err
+	}
+	entries, err := from.ReadLogs("", "")
+	if err != nil {
+		return err
+	}
+	copied, err := copyLogs(entries, to)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"no_accounts":    len(accounts),
+		"no_characters":  len(characters),
+		"no_bans":        len(bans),
+		"no_log_entries": copied,
+	}).Info("Storage migrated.")
+	return nil
+}
+
+// Appends those of entries that Store to doesn't already have, then checks
+// it has all of them. Returns how many were appended.
+func copyLogs(entries []LogEntry, to Store) (int, error) {
+	present, err := to.ReadLogs("", "")
+	if err != nil {
+		return 0, err
+	}
+	// Counted rather than just noted, in case the same thing was logged twice
+	// at once.
+	count := make(map[logKey]int)
+	for _, entry := range present {
+		count[entry.key()]++
+	}
+	copied := 0
+	for _, entry := range entries {
+		if count[entry.key()] > 0 {
+			count[entry.key()]--
+			continue
+		}
+		if err := to.AppendLog(entry); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	present, err = to.ReadLogs("", "")
+	if err != nil {
+		return copied, err
+	}
+	count = make(map[logKey]int)
+	for _, entry := range present {
+		count[entry.key()]++
+	}
+	for _, entry := range entries {
+		if count[entry.key()] == 0 {
+			return copied, fmt.Errorf("Log entry '%v' did not migrate cleanly.", entry.Message)
+		}
+		count[entry.key()]--
+	}
+	return copied, nil
+}
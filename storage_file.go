@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// fileStore keeps data in a directory of flat files. Accounts, characters
+// and the world snapshot are YAML files, and each log stream is a file of
+// JSON lines.
+//
+//	<root>/accounts/<name>.yaml
+//	<root>/characters/<name>.yaml
+//	<root>/world.yaml
+//	<root>/logs/<stream>.log
+//
+// Log files are rotated once they reach logRotateSize, the older ones being
+// renamed <stream>.log.1, <stream>.log.2 and so on up to logRotateKeep.
+type fileStore struct {
+	root    string
+	logLock sync.Mutex
+}
+
+func openFileStore(root string) (*fileStore, error) {
+	for _, dir := range []string{"accounts", "characters", "logs"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &fileStore{root: root}, nil
+}
+
+func (f *fileStore) recordPath(kind, name string) string {
+	return filepath.Join(f.root, kind, strings.ToLower(name)+".yaml")
+}
+
+// Reads the YAML file at path into output.
+func readYAML(path string, output interface{}) error {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(raw, output)
+}
+
+// Writes input to the YAML file at path. The file is written to a temporary
+// file first, so a crash part way through leaves the previous one intact.
+func writeYAML(path string, input interface{}) error {
+	raw, err := yaml.Marshal(input)
+	if err != nil {
+		return err
+	}
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+// Lists the names of the records in the directory for kind.
+func (f *fileStore) listRecords(kind string) (names []string, err error) {
+	entries, err := os.ReadDir(filepath.Join(f.root, kind))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".yaml"); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (f *fileStore) LoadAccount(name string) (account Account, err error) {
+	err = readYAML(f.recordPath("accounts", name), &account)
+	return
+}
+
+func (f *fileStore) SaveAccount(account Account) error {
+	return writeYAML(f.recordPath("accounts", account.Name), account)
+}
+
+func (f *fileStore) ListAccounts() ([]string, error) {
+	return f.listRecords("accounts")
+}
+
+func (f *fileStore) LoadCharacter(name string) (character Character, err error) {
+	err = readYAML(f.recordPath("characters", name), &character)
+	return
+}
+
+func (f *fileStore) SaveCharacter(character Character) error {
+	return writeYAML(f.recordPath("characters", character.Name), character)
+}
+
+func (f *fileStore) ListCharacters() ([]string, error) {
+	return f.listRecords("characters")
+}
+
+func (f *fileStore) LoadSnapshot() (snapshot WorldSnapshot, err error) {
+	err = readYAML(filepath.Join(f.root, "world.yaml"), &snapshot)
+	return
+}
+
+func (f *fileStore) SaveSnapshot(snapshot WorldSnapshot) error {
+	return writeYAML(filepath.Join(f.root, "world.yaml"), snapshot)
+}
+
+func (f *fileStore) LoadBans() (bans []Ban, err error) {
+	err = readYAML(filepath.Join(f.root, "bans.yaml"), &bans)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return
+}
+
+func (f *fileStore) SaveBans(bans []Ban) error {
+	return writeYAML(filepath.Join(f.root, "bans.yaml"), bans)
+}
+
+// Size a log file can grow to before it's rotated, and how many rotated files
+// are kept for each stream.
+const (
+	logRotateSize = 10 << 20
+	logRotateKeep = 5
+)
+
+func (f *fileStore) logPath(stream string) string {
+	return filepath.Join(f.root, "logs", stream+".log")
+}
+
+func (f *fileStore) AppendLog(entry LogEntry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f.logLock.Lock()
+	defer f.logLock.Unlock()
+	if err := f.rotateLog(entry.Stream, len(raw)+1); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.logPath(entry.Stream), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(raw, '\n'))
+	return err
+}
+
+// Rotates the stream's log file if writing size more bytes to it would take
+// it past logRotateSize. Must be called with logLock held.
+func (f *fileStore) rotateLog(stream string, size int) error {
+	path := f.logPath(stream)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) || err == nil && info.Size()+int64(size) <= logRotateSize {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for i := logRotateKeep - 1; i >= 1; i-- {
+		older := fmt.Sprintf("%v.%v", path, i)
+		if err := os.Rename(older, fmt.Sprintf("%v.%v", path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
+
+// Reads the current and rotated log files of the stream, or of every stream
+// if it's empty.
+func (f *fileStore) ReadLogs(stream, player string) (entries []LogEntry, err error) {
+	if stream == "" {
+		stream = "*"
+	}
+	paths, err := filepath.Glob(f.logPath(stream) + "*")
+	if err != nil {
+		return nil, err
+	}
+	f.logLock.Lock()
+	defer f.logLock.Unlock()
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var entry LogEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue
+			}
+			if player == "" || strings.EqualFold(entry.Player, player) {
+				entries = append(entries, entry)
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	sortLogs(entries)
+	return entries, nil
+}
+
+func (f *fileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore keeps data in an embedded SQLite database.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS accounts (
+	name    TEXT PRIMARY KEY COLLATE NOCASE,
+	builder INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS characters (
+	name     TEXT PRIMARY KEY COLLATE NOCASE,
+	location TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS visited (
+	name    TEXT NOT NULL COLLATE NOCASE,
+	room_id TEXT NOT NULL,
+	PRIMARY KEY (name, room_id)
+);
+CREATE TABLE IF NOT EXISTS snapshots (
+	id    INTEGER PRIMARY KEY CHECK (id = 1),
+	saved TEXT NOT NULL,
+	data  TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS logs (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	time    TEXT NOT NULL,
+	stream  TEXT NOT NULL,
+	player  TEXT NOT NULL,
+	message TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS logs_player ON logs (player COLLATE NOCASE);
+`
+
+// Changes made to the schema since it was first written, applied in order.
+// The database's user_version records how many have been applied.
+var sqliteMigrations = []string{
+	`ALTER TABLE accounts ADD COLUMN admin INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE accounts ADD COLUMN preferences TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE accounts ADD COLUMN ssh_keys TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE bans (
+		address TEXT PRIMARY KEY,
+		reason  TEXT NOT NULL,
+		by      TEXT NOT NULL,
+		time    TEXT NOT NULL
+	)`,
+}
+
+// Brings the database's schema up to date.
+func (ss *sqliteStore) migrate() error {
+	if _, err := ss.db.Exec(sqliteSchema); err != nil {
+		return err
+	}
+	var version int
+	if err := ss.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(sqliteMigrations); version++ {
+		if _, err := ss.db.Exec(sqliteMigrations[version]); err != nil {
+			return fmt.Errorf("Could not apply schema migration %v: %w", version+1, err)
+		}
+		if _, err := ss.db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows one writer at a time.
+	db.SetMaxOpenConns(1)
+	ss := &sqliteStore{db: db}
+	if err := ss.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return ss, nil
+}
+
+// Runs query, which selects a single column, returning every value.
+func (ss *sqliteStore) listColumn(query string, args ...interface{}) (values []string, err error) {
+	rows, err := ss.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// Preferences are kept as a YAML document, so new ones don't need a change
+// to the schema.
+func (ss *sqliteStore) LoadAccount(name string) (account Account, err error) {
+	var prefs, keys string
+	err = ss.db.QueryRow(`SELECT name, builder, admin, preferences, ssh_keys FROM accounts WHERE name = ?`, name).
+		Scan(&account.Name, &account.Builder, &account.Admin, &prefs, &keys)
+	if errors.Is(err, sql.ErrNoRows) {
+		return account, ErrNotFound
+	} else if err != nil {
+		return
+	}
+	// Keys are kept one per line, as in an authorized_keys file.
+	if keys != "" {
+		account.SSHKeys = strings.Split(keys, "\n")
+	}
+	err = yaml.Unmarshal([]byte(prefs), &account.Preferences)
+	return
+}
+
+func (ss *sqliteStore) SaveAccount(account Account) error {
+	prefs, err := yaml.Marshal(account.Preferences)
+	if err != nil {
+		return err
+	}
+	_, err = ss.db.Exec(`INSERT INTO accounts (name, builder, admin, preferences, ssh_keys) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET builder = excluded.builder, admin = excluded.admin,
+			preferences = excluded.preferences, ssh_keys = excluded.ssh_keys`,
+		account.Name, account.Builder, account.Admin, string(prefs), strings.Join(account.SSHKeys, "\n"))
+	return err
+}
+
+func (ss *sqliteStore) ListAccounts() ([]string, error) {
+	return ss.listColumn(`SELECT name FROM accounts ORDER BY name`)
+}
+
+func (ss *sqliteStore) LoadCharacter(name string) (character Character, err error) {
+	err = ss.db.QueryRow(`SELECT name, location FROM characters WHERE name = ?`, name).
+		Scan(&character.Name, &character.Location)
+	if errors.Is(err, sql.ErrNoRows) {
+		return character, ErrNotFound
+	} else if err != nil {
+		return
+	}
+	character.Visited, err = ss.listColumn(`SELECT room_id FROM visited WHERE name = ? ORDER BY room_id`, name)
+	return
+}
+
+func (ss *sqliteStore) SaveCharacter(character Character) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO characters (name, location) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET location = excluded.location`,
+		character.Name, character.Location); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM visited WHERE name = ?`, character.Name); err != nil {
+		return err
+	}
+	for _, id := range character.Visited {
+		if _, err := tx.Exec(`INSERT INTO visited (name, room_id) VALUES (?, ?)`, character.Name, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (ss *sqliteStore) ListCharacters() ([]string, error) {
+	return ss.listColumn(`SELECT name FROM characters ORDER BY name`)
+}
+
+// Snapshots are kept as a single YAML document, in the same format the file
+// store uses.
+func (ss *sqliteStore) LoadSnapshot() (snapshot WorldSnapshot, err error) {
+	var data string
+	err = ss.db.QueryRow(`SELECT data FROM snapshots WHERE id = 1`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return snapshot, ErrNotFound
+	} else if err != nil {
+		return
+	}
+	err = yaml.Unmarshal([]byte(data), &snapshot)
+	return
+}
+
+func (ss *sqliteStore) SaveSnapshot(snapshot WorldSnapshot) error {
+	data, err := yaml.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = ss.db.Exec(`INSERT INTO snapshots (id, saved, data) VALUES (1, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET saved = excluded.saved, data = excluded.data`,
+		snapshot.Saved.Format(time.RFC3339Nano), string(data))
+	return err
+}
+
+// Bans are read back in the order they were saved in.
+func (ss *sqliteStore) LoadBans() (bans []Ban, err error) {
+	rows, err := ss.db.Query(`SELECT address, reason, by, time FROM bans ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ban Ban
+		var raw string
+		if err := rows.Scan(&ban.Address, &ban.Reason, &ban.By, &raw); err != nil {
+			return nil, err
+		}
+		if ban.Time, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+
+// The whole ban list is replaced each time it's saved.
+func (ss *sqliteStore) SaveBans(bans []Ban) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM bans`); err != nil {
+		return err
+	}
+	for _, ban := range bans {
+		if _, err := tx.Exec(`INSERT INTO bans (address, reason, by, time) VALUES (?, ?, ?, ?)`,
+			ban.Address, ban.Reason, ban.By, ban.Time.Format(time.RFC3339Nano)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (ss *sqliteStore) AppendLog(entry LogEntry) error {
+	_, err := ss.db.Exec(`INSERT INTO logs (time, stream, player, message) VALUES (?, ?, ?, ?)`,
+		entry.Time.Format(time.RFC3339Nano), entry.Stream, entry.Player, entry.Message)
+	return err
+}
+
+// Times are kept as text, which doesn't sort in time order, so entries are
+// read in the order they were appended and sorted once they're parsed.
+func (ss *sqliteStore) ReadLogs(stream, player string) (entries []LogEntry, err error) {
+	rows, err := ss.db.Query(`SELECT time, stream, player, message FROM logs
+		WHERE (? = '' OR stream = ?) AND (? = '' OR player = ? COLLATE NOCASE)
+		ORDER BY id`, stream, stream, player, player)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry LogEntry
+		var raw string
+		if err := rows.Scan(&raw, &entry.Stream, &entry.Player, &entry.Message); err != nil {
+			return nil, err
+		}
+		if entry.Time, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortLogs(entries)
+	return entries, nil
+}
+
+func (ss *sqliteStore) Close() error {
+	return ss.db.Close()
+}
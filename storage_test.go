@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Time the records saved by the tests are made at.
+var storeTestTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Each kind of Store, opened in a fresh directory.
+var testStores = []struct {
+	kind string
+	open func(dir string) (Store, error)
+}{
+	{storeFile, func(dir string) (Store, error) { return openFileStore(dir) }},
+	{storeSQLite, func(dir string) (Store, error) { return openSQLiteStore(filepath.Join(dir, "game.db")) }},
+}
+
+// Runs test against each kind of Store.
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	for _, kind := range testStores {
+		t.Run(kind.kind, func(t *testing.T) {
+			s, err := kind.open(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			test(t, s)
+		})
+	}
+}
+
+func TestStoreAccounts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		if _, err := s.LoadAccount("alice"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Loading a missing account gave %v, want ErrNotFound.", err)
+		}
+		alice := Account{
+			Name:        "Alice",
+			Admin:       true,
+			Preferences: Preferences{Colour: "on", Theme: map[string]string{"title": "red"}},
+			SSHKeys:     []string{"ssh-ed25519 AAAA alice@home", "ssh-ed25519 BBBB alice@work"},
+		}
+		bob := Account{Name: "bob", Builder: true}
+		for _, account := range []Account{alice, bob} {
+			if err := s.SaveAccount(account); err != nil {
+				t.Fatal(err)
+			}
+		}
+		loaded, err := s.LoadAccount("ALICE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(normalAccount(loaded), normalAccount(alice)) {
+			t.Errorf("Loaded %+v, want %+v.", loaded, alice)
+		}
+		bob.Builder = false
+		if err := s.SaveAccount(bob); err != nil {
+			t.Fatal(err)
+		}
+		if loaded, err := s.LoadAccount("bob"); err != nil || loaded.Builder {
+			t.Errorf("Saving bob again gave %+v, %v.", loaded, err)
+		}
+		names, err := s.ListAccounts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 2 {
+			t.Errorf("Listed accounts %v, want alice and bob.", names)
+		}
+	})
+}
+
+func TestStoreCharacters(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		if _, err := s.LoadCharacter("alice"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Loading a missing character gave %v, want ErrNotFound.", err)
+		}
+		alice := Character{Name: "alice", Visited: []string{"2-0", "0-0", "1-0"}, Location: "2-0"}
+		if err := s.SaveCharacter(alice); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := s.LoadCharacter("Alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(normalCharacter(loaded), normalCharacter(alice)) {
+			t.Errorf("Loaded %+v, want %+v.", loaded, alice)
+		}
+		// Saving again replaces the Rooms visited rather than adding to them.
+		alice.Visited = []string{"0-0"}
+		if err := s.SaveCharacter(alice); err != nil {
+			t.Fatal(err)
+		}
+		if loaded, err := s.LoadCharacter("alice"); err != nil || len(loaded.Visited) != 1 {
+			t.Errorf("Saving alice again gave %+v, %v.", loaded, err)
+		}
+		names, err := s.ListCharacters()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 1 {
+			t.Errorf("Listed characters %v, want alice.", names)
+		}
+	})
+}
+
+func TestStoreSnapshot(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		if _, err := s.LoadSnapshot(); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Loading a missing snapshot gave %v, want ErrNotFound.", err)
+		}
+		snapshot := WorldSnapshot{
+			Saved: storeTestTime,
+			Rooms: []RoomSnapshot{{ID: "1-0", Doors: map[string]bool{"South": false}}},
+		}
+		if err := s.SaveSnapshot(snapshot); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := s.LoadSnapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !loaded.Saved.Equal(snapshot.Saved) || !reflect.DeepEqual(loaded.Rooms, snapshot.Rooms) {
+			t.Errorf("Loaded %+v, want %+v.", loaded, snapshot)
+		}
+	})
+}
+
+func TestStoreBans(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		if loaded, err := s.LoadBans(); err != nil || len(loaded) != 0 {
+			t.Fatalf("Loading bans before any were saved gave %v, %v.", loaded, err)
+		}
+		// The later ban's time sorts before the earlier one's as text.
+		bans := []Ban{
+			{Address: "10.0.0.0/8", Reason: "Spam", By: "alice", Time: storeTestTime},
+			{Address: "192.168.0.1", Reason: "Abuse", By: "alice", Time: storeTestTime.Add(time.Second / 2)},
+		}
+		if err := s.SaveBans(bans); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := s.LoadBans()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(loaded) != len(bans) {
+			t.Fatalf("Loaded %v bans, want %v.", len(loaded), len(bans))
+		}
+		for i := range bans {
+			if loaded[i].Address != bans[i].Address || !loaded[i].Time.Equal(bans[i].Time) {
+				t.Errorf("Ban %v was %+v, want %+v.", i, loaded[i], bans[i])
+			}
+		}
+	})
+}
+
+func TestStoreLogs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		// Times with fewer digits after the second sort out of order as
+		// RFC 3339 text. The third entry is appended late, and the last two
+		// share a time.
+		entries := []LogEntry{
+			{Time: storeTestTime, Stream: "audit", Player: "alice", Message: "First."},
+			{Time: storeTestTime.Add(time.Second / 2), Stream: "audit", Player: "bob", Message: "Second."},
+			{Time: storeTestTime.Add(time.Second + time.Millisecond), Stream: "audit", Player: "Alice", Message: "Fourth."},
+			{Time: storeTestTime.Add(time.Second), Stream: "commands", Player: "alice", Message: "Third."},
+			{Time: storeTestTime.Add(time.Second + time.Millisecond), Stream: "audit", Player: "bob", Message: "Fifth."},
+		}
+		for _, entry := range entries {
+			if err := s.AppendLog(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, test := range []struct {
+			stream, player string
+			want           []string
+		}{
+			{"", "", []string{"First.", "Second.", "Third.", "Fourth.", "Fifth."}},
+			{"audit", "", []string{"First.", "Second.", "Fourth.", "Fifth."}},
+			{"", "alice", []string{"First.", "Third.", "Fourth."}},
+			{"audit", "bob", []string{"Second.", "Fifth."}},
+			{"chat", "", nil},
+		} {
+			read, err := s.ReadLogs(test.stream, test.player)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var messages []string
+			for _, entry := range read {
+				messages = append(messages, entry.Message)
+			}
+			if !reflect.DeepEqual(messages, test.want) {
+				t.Errorf("ReadLogs(%q, %q) gave %v, want %v.", test.stream, test.player, messages, test.want)
+			}
+		}
+	})
+}
+
+func TestMigrateStore(t *testing.T) {
+	for _, from := range testStores {
+		for _, to := range testStores {
+			if from.kind == to.kind {
+				continue
+			}
+			t.Run(from.kind+"-"+to.kind, func(t *testing.T) {
+				source, err := from.open(t.TempDir())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer source.Close()
+				dest, err := to.open(t.TempDir())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer dest.Close()
+				// Nothing visited, no keys and no theme come back as empty
+				// from one Store and nil from the other.
+				saves := []error{
+					source.SaveAccount(Account{Name: "alice", SSHKeys: []string{}, Preferences: Preferences{Theme: map[string]string{}}}),
+					source.SaveAccount(Account{Name: "bob", Preferences: Preferences{Theme: map[string]string{"exits": "green"}}}),
+					source.SaveCharacter(Character{Name: "alice", Visited: []string{}, Location: "0-0"}),
+					source.SaveCharacter(Character{Name: "bob", Visited: []string{"1-0", "0-0"}, Location: "1-0"}),
+					source.SaveBans([]Ban{{Address: "10.0.0.1", Reason: "Spam", By: "alice", Time: storeTestTime}}),
+					source.AppendLog(LogEntry{Time: storeTestTime, Stream: "audit", Player: "alice", Message: "Banned 10.0.0.1."}),
+					source.AppendLog(LogEntry{Time: storeTestTime.Add(time.Second), Stream: "chat", Player: "bob", Message: "Hello."}),
+				}
+				for _, err := range saves {
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				// Running it again, as after one that stopped part way
+				// through, doesn't copy the log entries twice.
+				for i := 0; i < 2; i++ {
+					if err := migrateStore(source, dest); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if names, err := dest.ListCharacters(); err != nil || len(names) != 2 {
+					t.Errorf("Migrated characters %v, %v.", names, err)
+				}
+				if loaded, err := dest.LoadBans(); err != nil || len(loaded) != 1 {
+					t.Errorf("Migrated bans %v, %v.", loaded, err)
+				}
+				if entries, err := dest.ReadLogs("", ""); err != nil || len(entries) != 2 {
+					t.Errorf("Migrated log entries %v, %v.", entries, err)
+				}
+			})
+		}
+	}
+}
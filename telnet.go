@@ -0,0 +1,180 @@
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// Telnet command and option codes (RFC 854, RFC 1073).
+const (
+	telnetEOR  byte = 239
+	telnetSE   byte = 240
+	telnetGA   byte = 249
+	telnetSB   byte = 250
+	telnetWILL byte = 251
+	telnetWONT byte = 252
+	telnetDO   byte = 253
+	telnetDONT byte = 254
+	telnetIAC  byte = 255
+
+	telnetTTYPE     byte = 24
+	telnetEOROption byte = 25
+	telnetNAWS      byte = 31
+
+	// Subnegotiation commands for TTYPE (RFC 1091).
+	telnetTTYPEIs   byte = 0
+	telnetTTYPESend byte = 1
+)
+
+// States the telnetReader passes through while parsing the input stream.
+const (
+	telnetStateData = iota
+	telnetStateIAC
+	telnetStateOption
+	telnetStateSub
+	telnetStateSubIAC
+)
+
+// Builds a three byte telnet negotiation, e.g. IAC DO NAWS.
+func telnetCommand(command, option byte) []byte {
+	return []byte{telnetIAC, command, option}
+}
+
+// Builds a telnet subnegotiation for option carrying data.
+func telnetSubnegotiation(option byte, data ...byte) []byte {
+	output := []byte{telnetIAC, telnetSB, option}
+	for _, b := range data {
+		if b == telnetIAC {
+			output = append(output, telnetIAC)
+		}
+		output = append(output, b)
+	}
+	return append(output, telnetIAC, telnetSE)
+}
+
+// Terminal types that can't show colour.
+var monochromeTerminals = map[string]bool{
+	"DUMB":    true,
+	"UNKNOWN": true,
+}
+
+// telnetReader wraps a connection's input, removing telnet negotiation from
+// the stream and acting on the options the server understands. Everything
+// else is passed through to the reader unchanged.
+type telnetReader struct {
+	source  io.Reader
+	user    *User
+	state   int
+	command byte
+	sub     []byte
+}
+
+func newTelnetReader(source io.Reader, user *User) *telnetReader {
+	return &telnetReader{source: source, user: user}
+}
+
+func (t *telnetReader) Read(p []byte) (int, error) {
+	buffer := make([]byte, len(p))
+	for {
+		bytesRead, err := t.source.Read(buffer)
+		n := 0
+		for _, b := range buffer[:bytesRead] {
+			if t.parse(b) {
+				p[n] = b
+				n++
+			}
+		}
+		// Don't hand back an empty read just because the client only sent
+		// negotiation.
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// Feeds a single byte through the parser. Returns true if the byte is data
+// that should be passed on.
+func (t *telnetReader) parse(b byte) bool {
+	switch t.state {
+	case telnetStateData:
+		if b == telnetIAC {
+			t.state = telnetStateIAC
+			return false
+		}
+		return true
+	case telnetStateIAC:
+		switch b {
+		case telnetIAC: // An escaped 255 is data.
+			t.state = telnetStateData
+			return true
+		case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+			t.command = b
+			t.state = telnetStateOption
+		case telnetSB:
+			t.sub = t.sub[:0]
+			t.state = telnetStateSub
+		default:
+			t.state = telnetStateData
+		}
+	case telnetStateOption:
+		t.negotiate(t.command, b)
+		t.state = telnetStateData
+	case telnetStateSub:
+		if b == telnetIAC {
+			t.state = telnetStateSubIAC
+		} else {
+			t.sub = append(t.sub, b)
+		}
+	case telnetStateSubIAC:
+		switch b {
+		case telnetSE:
+			if len(t.sub) > 0 {
+				t.subnegotiate(t.sub[0], t.sub[1:])
+			}
+			t.state = telnetStateData
+		case telnetIAC:
+			t.sub = append(t.sub, b)
+			t.state = telnetStateSub
+		default:
+			t.state = telnetStateData
+		}
+	}
+	return false
+}
+
+// Handles the client agreeing or refusing to use an option.
+func (t *telnetReader) negotiate(command, option byte) {
+	switch {
+	case command == telnetWILL && option == telnetTTYPE:
+		t.user.Conn.Write(telnetSubnegotiation(telnetTTYPE, telnetTTYPESend))
+	case option == telnetEOROption:
+		t.user.useEOR.Store(command == telnetDO)
+	case option == telnetGMCP:
+		t.user.gmcp.Store(command == telnetDO)
+	case option == telnetCOMPRESS2:
+		if mc, ok := t.user.Conn.(*mccpConn); ok && command == telnetDO {
+			mc.startCompression()
+		} else if ok && command == telnetDONT {
+			mc.stopCompression()
+		}
+	}
+}
+
+// Handles the payload of a subnegotiation for 'option'.
+func (t *telnetReader) subnegotiate(option byte, data []byte) {
+	switch option {
+	case telnetNAWS:
+		if len(data) == 4 {
+			width := int(data[0])<<8 | int(data[1])
+			height := int(data[2])<<8 | int(data[3])
+			t.user.setWindowSize(width, height)
+		}
+	case telnetTTYPE:
+		if len(data) > 1 && data[0] == telnetTTYPEIs {
+			terminal := strings.ToUpper(string(data[1:]))
+			t.user.clientANSI.Store(!monochromeTerminals[terminal])
+		}
+	case telnetGMCP:
+		t.user.receiveGMCP(data)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestTelnetOutputEscapesIACAndMarksPrompts(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		telnet bool
+		eor    bool
+		want   string
+	}{
+		{"GA", true, false, "caf\xff\xff\n> \xff\xf9"},
+		{"EOR", true, true, "caf\xff\xff\n> \xff\xef"},
+		{"plain", false, false, "caf\xff\n> "},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conn := newHarnessConn("telnet")
+			u := &User{Conn: conn, Mob: newMob(), telnet: test.telnet}
+			u.useEOR.Store(test.eor)
+			u.deliver(Output{Text: "caf\xff\n"})
+			u.deliver(Output{Text: "> ", Prompt: true})
+			if got := conn.takeOutput(); got != test.want {
+				t.Errorf("Sent %q, want %q.", got, test.want)
+			}
+		})
+	}
+}
@@ -4,3 +4,22 @@ type Thing interface {
 	getDescription() string
 	getName() string
 }
+
+// Items are inanimate Things, such as those left lying on the floor of a
+// Room.
+type Item struct {
+	name        string
+	description string
+}
+
+func newItem(name, description string) *Item {
+	return &Item{name: name, description: description}
+}
+
+func (i *Item) getDescription() string {
+	return i.description
+}
+
+func (i *Item) getName() string {
+	return i.name
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+// The browser client, served from the root of the web listener.
+//
+//go:embed webclient
+var webClientFiles embed.FS
+
+// webSocketConn is a WebSocket connection that reports the address of the
+// client, rather than the page it connected from, as its remote address.
+type webSocketConn struct {
+	*websocket.Conn
+	remote net.Addr
+}
+
+func (wc webSocketConn) RemoteAddr() net.Addr {
+	return wc.remote
+}
+
+// Runs a session for a browser connected over a WebSocket. The browser
+// client understands ANSI colour, so it's turned on unless the player says
+// otherwise.
+func handleWebSocket(ws *websocket.Conn) {
+	ws.PayloadType = websocket.TextFrame
+	var conn net.Conn = ws
+	if remote, err := net.ResolveTCPAddr("tcp", ws.Request().RemoteAddr); err == nil {
+		conn = webSocketConn{ws, remote}
+	}
+	if !admitConnection(conn) {
+		return
+	}
+	defer releaseConnection(conn)
+	handleConnection(conn, false, "")
+}
+
+// Starts serving the browser client, and the WebSocket it connects to, on
+// addr.
+func serveWebClient(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	files, err := fs.Sub(webClientFiles, "webclient")
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(files)))
+	mux.Handle("/ws", websocket.Handler(handleWebSocket))
+	log.Infof("Web client is being served on port %v", addr)
+	go func() {
+		log.WithError(http.Serve(listener, mux)).Fatal("Web client stopped.")
+	}()
+	return nil
+}
@@ -2,28 +2,56 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 type World struct {
 	sync.Mutex
-	rooms   []*Room
-	running bool
-	things  []chan interface{}
+	areas     []*Area
+	rooms     []*Room
+	roomsByID map[string]*Room
+	running   bool
+	things    []chan interface{}
+	tick      time.Duration // How long each beat of the world lasts
+	ticks     atomic.Int64  // How many beats the world has been running for, read without holding the lock
+	autosave  time.Duration // How often the world is saved, zero for never
+	store     Store         // Where the world's snapshot is kept, autosave is off if nil
+	saving    sync.Mutex    // Held while a save is in progress
+	clock     Clock         // Drives the beat and everything else timed in the world
+	started   time.Time     // When the world started, by its clock
 }
 
-func newWorld(rooms []*Room) *World {
-	return &World{
-		rooms:   rooms,
-		running: false,
+func newWorld(areas ...*Area) *World {
+	w := &World{
+		areas:     areas,
+		roomsByID: make(map[string]*Room),
+		running:   false,
+		tick:      time.Millisecond,
+		clock:     realClock{},
+	}
+	for _, area := range areas {
+		w.rooms = append(w.rooms, area.rooms...)
+		for _, room := range area.rooms {
+			w.roomsByID[room.id] = room
+		}
 	}
+	return w
 }
 
 func (w *World) getStartRoom() *Room {
 	return w.rooms[0]
 }
 
+// Returns the Room with the given ID, or nil if there isn't one.
+func (w *World) getRoom(id string) *Room {
+	return w.roomsByID[id]
+}
+
 func (w *World) registerThing(p Pulsable) (pulse <-chan interface{}, err error) {
 	if w.running {
 		w.Lock()
@@ -38,35 +66,158 @@ func (w *World) registerThing(p Pulsable) (pulse <-chan interface{}, err error)
 }
 
 func (w *World) startWorld() {
+	w.started = w.clock.Now()
 	w.running = true
 	go w.beat()
 }
 
+// Starts the world on clock without a beat of its own, so that it only
+// moves on when it's stepped.
+func (w *World) startStepped(clock Clock) {
+	w.clock = clock
+	w.started = clock.Now()
+	w.running = true
+}
+
+// Returns how many beats the world has been running for.
+func (w *World) beats() int {
+	return int(w.ticks.Load())
+}
+
+// Returns how long the world has been running for, by its clock.
+func (w *World) uptime() time.Duration {
+	return w.clock.Now().Sub(w.started)
+}
+
+// Stops sending pulses to a thing that's leaving the world, closing its
+// pulse channel.
+func (w *World) unregisterThing(pulse <-chan interface{}) {
+	w.Lock()
+	defer w.Unlock()
+	for i, thing := range w.things {
+		if thing == pulse {
+			w.things = append(w.things[:i], w.things[i+1:]...)
+			close(thing)
+			return
+		}
+	}
+}
+
 func (w *World) stopWorld() {
 	w.running = false
 	w.Mutex.Lock()
 	for _, thing := range w.things {
 		close(thing)
 	}
+	w.things = nil
 	w.Mutex.Unlock()
 }
 
 func (w *World) beat() {
 	for {
-		time.Sleep(time.Millisecond)
+		w.clock.Sleep(w.tick)
+		started := w.clock.Now()
 		w.Mutex.Lock()
 		for _, thing := range w.things {
-			thing <- true
+			// A thing that's fallen behind misses the pulse rather than
+			// holding up the beat, as it may be waiting on the world itself,
+			// e.g. to unregister.
+			select {
+			case thing <- true:
+			default:
+			}
 		}
+		w.ticks.Add(1)
+		autosave := w.autosaveDue()
 		w.Mutex.Unlock()
+		metrics.observeTick(w.clock.Now().Sub(started))
+		if autosave {
+			go w.save()
+		}
+	}
+}
+
+// Sends everything in the world one pulse, as a beat does, and waits for
+// each of them to handle it. Used to run a world started with startStepped
+// a beat at a time; its clock needs advancing to match.
+func (w *World) step() {
+	var handled sync.WaitGroup
+	w.Mutex.Lock()
+	handled.Add(len(w.things))
+	for _, thing := range w.things {
+		thing <- &handled
+	}
+	w.ticks.Add(1)
+	w.Mutex.Unlock()
+	handled.Wait()
+}
+
+// Returns true if the world should be saved on this beat.
+func (w *World) autosaveDue() bool {
+	if w.store == nil || w.autosave <= 0 {
+		return false
+	}
+	every := int(w.autosave / w.tick)
+	return every <= 1 || w.ticks.Load()%int64(every) == 0
+}
+
+// Saves the world's snapshot and the accounts of everyone in it. If a
+// save is already underway, this one is skipped.
+func (w *World) save() {
+	if !w.saving.TryLock() {
+		return
+	}
+	defer w.saving.Unlock()
+	if err := w.store.SaveSnapshot(w.snapshot()); err != nil {
+		log.WithError(err).Error("Could not save the world.")
+	}
+	usersLock.Lock()
+	mobs := []*Mob{}
+	for _, user := range users {
+		mobs = append(mobs, user.Mob)
+	}
+	usersLock.Unlock()
+	mobs = append(mobs, linkdeadList()...)
+	for _, mob := range mobs {
+		if err := mob.save(); err != nil {
+			log.WithError(err).Errorf("Could not save account '%v'.", mob.name)
+		}
+	}
+	log.Info("World saved.")
+}
+
+// Reloads the text of the Area called name from the world directory, so
+// builders can fix descriptions without restarting. Rooms are matched by
+// ID; any that have been added or removed need a restart to appear or go.
+func (w *World) reloadArea(name string) (updated, skipped int, err error) {
+	if name != filepath.Base(config.WorldDir) {
+		return 0, 0, fmt.Errorf("There's no area called '%v' to reload.", name)
+	}
+	fresh, err := loadMap(config.WorldDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, room := range fresh.rooms {
+		existing := w.getRoom(room.id)
+		if existing == nil {
+			skipped++
+			continue
+		}
+		existing.Lock()
+		existing.name = room.name
+		existing.description = room.description
+		existing.Unlock()
+		updated++
 	}
+	log.WithFields(log.Fields{"area": name, "updated": updated, "skipped": skipped}).Info("Area reloaded.")
+	return updated, skipped, nil
 }
 
 func (w *World) roomEmit(sound string, location *Room) {
 	usersLock.Lock()
 	for _, user := range users {
-		if user.Mob.location.name == location.name {
-			user.Mob.print <- sound
+		if user.Mob.getLocation() == location {
+			user.Mob.tell(sound)
 		}
 	}
 	usersLock.Unlock()